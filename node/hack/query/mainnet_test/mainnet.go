@@ -18,6 +18,18 @@
 // - After a few minutes, you should see a message saying "Got peers". If you do not, then test is unable to communicate with any guardians.
 // - After this, the test runs, and you should eventually see "Success! Test passed"
 //
+// This tool uses node/pkg/query/client, which accumulates guardian
+// signatures until quorum (2/3+1) is reached and verifies each signature
+// against the guardian set read from the core contract on mainnet Ethereum,
+// rather than accepting the first gossip response it sees.
+//
+// If you are running behind a home router or a cloud NAT and see "Waiting
+// for peers" with no progress, try `--nat enabled` so the host attempts to
+// open a port mapping (via whichever of UPnP or NAT-PMP the router
+// supports), or `--announceAddr` if you already know a reachable address
+// for this host. `--diagnose` reports what the host was able to learn
+// about its own reachability without needing to bootstrap a full test run.
+//
 // To run the tool as a docker image, you can do something like this:
 // - wormhole$ docker build --target build -f node/hack/query/mainnet_test/Dockerfile -t mainnet-test .
 // - wormhole$ docker run -v /mainnet_test/cfg:/app/cfg mainnet-test /mainnet_test --configDir /app/cfg
@@ -28,12 +40,12 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"crypto/ecdsa"
 	"encoding/hex"
 	"flag"
 	"fmt"
+	"math/big"
 	"os"
 	"os/signal"
 	"strings"
@@ -43,16 +55,20 @@ import (
 	"github.com/certusone/wormhole/node/hack/query/utils"
 	"github.com/certusone/wormhole/node/pkg/common"
 	"github.com/certusone/wormhole/node/pkg/p2p"
-	gossipv1 "github.com/certusone/wormhole/node/pkg/proto/gossip/v1"
 	"github.com/certusone/wormhole/node/pkg/query"
+	queryClient "github.com/certusone/wormhole/node/pkg/query/client"
 	"github.com/ethereum/go-ethereum/accounts/abi"
+	ethCommon "github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	ethCrypto "github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
 	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/multiformats/go-multiaddr"
 	"github.com/tendermint/tendermint/libs/rand"
 	"go.uber.org/zap"
-	"google.golang.org/protobuf/proto"
 )
 
 var (
@@ -61,10 +77,24 @@ var (
 	p2pBootstrap = flag.String("bootstrap",
 		"/dns4/wormhole-mainnet-v2-bootstrap.certus.one/udp/8996/quic/p2p/12D3KooWQp644DK27fd3d4Km3jr7gHiuJJ5ZGmy8hH4py7fP4FP7,/dns4/wormhole-v2-mainnet-bootstrap.xlabs.xyz/udp/8996/quic/p2p/12D3KooWNQ9tVrcb64tw6bNs2CaNrUGPM7yRrKvBBheQ5yCyPHKC,/dns4/wormhole.mcf.rocks/udp/8996/quic/p2p/12D3KooWDZVv7BhZ8yFLkarNdaSWaB43D6UbQwExJ8nnGAEmfHcU,/dns4/wormhole-v2-mainnet-bootstrap.staking.fund/udp/8996/quic/p2p/12D3KooWG8obDX9DNi1KUwZNu9xkGwfKqTp2GFwuuHpWZ3nQruS1",
 		"P2P bootstrap peers (comma-separated)")
-	nodeKeyPath   = flag.String("nodeKey", "mainnet_test.nodeKey", "Path to node key (will be generated if it doesn't exist)")
-	signerKeyPath = flag.String("signerKey", "mainnet_test.signerKey", "Path to key used to sign unsigned queries")
-	configDir     = flag.String("configDir", ".", "Directory where nodeKey and signerKey are loaded from (default is .)")
-	targetPeerId  = flag.String("targetPeerId", "", "Only process responses from this peer ID (default is everything)")
+	nodeKeyPath     = flag.String("nodeKey", "mainnet_test.nodeKey", "Path to node key (will be generated if it doesn't exist)")
+	signerKeyPath   = flag.String("signerKey", "mainnet_test.signerKey", "Path to key used to sign unsigned queries")
+	configDir       = flag.String("configDir", ".", "Directory where nodeKey and signerKey are loaded from (default is .)")
+	targetPeerId    = flag.String("targetPeerId", "", "Only process responses from this peer ID (default is everything)")
+	ethRpcUrl       = flag.String("ethRpcUrl", "https://rpc.ankr.com/eth", "EVM RPC used to fetch the latest block and the guardian set")
+	ethCoreContract = flag.String("ethCoreContract", "0x98f3c9e6E48529E0AE4E8e24c6aE6c58F38D53e7", "Wormhole core contract on Ethereum mainnet")
+	queryTimeout    = flag.Duration("queryTimeout", queryClient.DefaultTimeout, "How long to wait for quorum before giving up")
+	queryType       = flag.String("queryType", "ethCall", "Which example query to send: \"ethCall\" or \"logFilter\"")
+	natPolicy       = flag.String("nat", "none", "NAT traversal to attempt: \"none\" or \"enabled\"")
+	announceAddr    = flag.String("announceAddr", "", "Explicit multiaddr to announce to peers instead of relying on discovery (e.g. /ip4/1.2.3.4/udp/8998/quic)")
+	diagnose        = flag.Bool("diagnose", false, "Report discovered addresses and AutoNAT reachability, then exit without sending a query")
+)
+
+// wethTransferTopic is the keccak256 hash of the ERC-20 Transfer(address,address,uint256) event signature.
+var wethTransferTopic = ethCommon.HexToHash("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef")
+
+const (
+	CCQ_SERVER_SIGNING_KEY = "CCQ SERVER SIGNING KEY"
 )
 
 func main() {
@@ -99,6 +129,18 @@ func main() {
 	// Manual p2p setup
 	components := p2p.DefaultComponents()
 	components.Port = uint(*p2pPort)
+	natPolicyValue, err := p2p.ParseNATPolicy(*natPolicy)
+	if err != nil {
+		logger.Fatal("invalid --nat", zap.Error(err))
+	}
+	components.NAT = natPolicyValue
+	if *announceAddr != "" {
+		ma, err := multiaddr.NewMultiaddr(*announceAddr)
+		if err != nil {
+			logger.Fatal("invalid --announceAddr", zap.String("announceAddr", *announceAddr), zap.Error(err))
+		}
+		components.AnnounceAddrs = []multiaddr.Multiaddr{ma}
+	}
 	bootstrapPeers := *p2pBootstrap
 	networkID := *p2pNetworkID + "/ccq"
 
@@ -107,6 +149,14 @@ func main() {
 		panic(err)
 	}
 
+	if *diagnose {
+		runDiagnose(ctx, logger, h)
+		if err := h.Close(); err != nil {
+			logger.Warn("error closing host", zap.Error(err))
+		}
+		return
+	}
+
 	topic_req := fmt.Sprintf("%s/%s", networkID, "ccq_req")
 	topic_resp := fmt.Sprintf("%s/%s", networkID, "ccq_resp")
 
@@ -155,54 +205,30 @@ func main() {
 	// END SETUP
 	//
 
-	wethAbi, err := abi.JSON(strings.NewReader("[{\"constant\":true,\"inputs\":[],\"name\":\"name\",\"outputs\":[{\"name\":\"\",\"type\":\"string\"}],\"payable\":false,\"stateMutability\":\"view\",\"type\":\"function\"},{\"constant\":true,\"inputs\":[],\"name\":\"totalSupply\",\"outputs\":[{\"name\":\"\",\"type\":\"uint256\"}],\"payable\":false,\"stateMutability\":\"view\",\"type\":\"function\"}]"))
+	logger.Info("Fetching guardian set", zap.String("url", *ethRpcUrl), zap.String("coreContract", *ethCoreContract))
+	guardianSet, err := queryClient.FetchGuardianSetFromEVM(ctx, *ethRpcUrl, ethCommon.HexToAddress(*ethCoreContract))
 	if err != nil {
-		panic(err)
-	}
-
-	methods := []string{"name", "totalSupply"}
-	callData := []*query.EthCallData{}
-	to, _ := hex.DecodeString("C02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2")
-
-	for _, method := range methods {
-		data, err := wethAbi.Pack(method)
-		if err != nil {
-			panic(err)
-		}
-
-		callData = append(callData, &query.EthCallData{
-			To:   to,
-			Data: data,
-		})
+		logger.Fatal("failed to fetch guardian set", zap.Error(err))
 	}
-
-	// Fetch the latest block number
-	//url := "https://localhost:8545"
-	url := "https://rpc.ankr.com/eth"
-	logger.Info("Querying for latest block height", zap.String("url", url))
-	blockNum, err := utils.FetchLatestBlockNumberFromUrl(ctx, url)
+	logger.Info("Guardian set loaded", zap.Uint32("index", guardianSet.Index), zap.Int("numGuardians", len(guardianSet.Addresses)))
+
+	qc, err := queryClient.New(logger, th_req, th_resp, sub, queryClient.Config{
+		Network:     common.MainNet,
+		Timeout:     *queryTimeout,
+		GuardianSet: guardianSet,
+		AllowedPeer: *targetPeerId,
+	})
 	if err != nil {
-		logger.Fatal("Failed to fetch latest block number", zap.Error(err))
+		logger.Fatal("failed to create query client", zap.Error(err))
 	}
 
-	logger.Info("latest block", zap.String("num", blockNum.String()), zap.String("encoded", hexutil.EncodeBig(blockNum)))
-
-	// block := "0x28d9630"
-	// block := "latest"
-	// block := "0x9999bac44d09a7f69ee7941819b0a19c59ccb1969640cc513be09ef95ed2d8e2"
-
-	// Start of query creation...
-	callRequest := &query.EthCallQueryRequest{
-		BlockId:  hexutil.EncodeBig(blockNum),
-		CallData: callData,
+	switch *queryType {
+	case "logFilter":
+		runLogFilterExample(ctx, logger, qc, sk)
+	default:
+		runEthCallExample(ctx, logger, qc, sk)
 	}
 
-	// Send 2 individual requests for the same thing but 5 blocks apart
-	// First request...
-	logger.Info("calling sendQueryAndGetRsp for ", zap.String("blockNum", blockNum.String()), zap.String("publicKey", ethCrypto.PubkeyToAddress(sk.PublicKey).Hex()))
-	queryRequest := createQueryRequest(callRequest)
-	sendQueryAndGetRsp(queryRequest, sk, th_req, ctx, logger, sub, wethAbi, methods)
-
 	// This is just so that when I look at the output, it is easier for me. (Paul)
 	logger.Info("sleeping for 5 seconds")
 	time.Sleep(time.Second * 5)
@@ -227,10 +253,6 @@ func main() {
 	logger.Info("Success! Test passed!")
 }
 
-const (
-	CCQ_SERVER_SIGNING_KEY = "CCQ SERVER SIGNING KEY"
-)
-
 func createQueryRequest(callRequest *query.EthCallQueryRequest) *query.QueryRequest {
 	queryRequest := &query.QueryRequest{
 		Nonce: rand.Uint32(),
@@ -260,124 +282,185 @@ func createQueryRequestWithMultipleRequests(callRequests []*query.EthCallQueryRe
 	return queryRequest
 }
 
-func sendQueryAndGetRsp(queryRequest *query.QueryRequest, sk *ecdsa.PrivateKey, th *pubsub.Topic, ctx context.Context, logger *zap.Logger, sub *pubsub.Subscription, wethAbi abi.ABI, methods []string) {
-	queryRequestBytes, err := queryRequest.Marshal()
+// runDiagnose reports what the host learned about its own reachability
+// (listen addresses and AutoNAT verdict) without bootstrapping a full
+// query, so operators can debug "Waiting for peers" hangs.
+func runDiagnose(ctx context.Context, logger *zap.Logger, h host.Host) {
+	logger.Info("diagnosing host reachability", zap.String("peer_id", h.ID().String()))
+	diagnosis, err := p2p.Diagnose(ctx, h, 30*time.Second)
 	if err != nil {
-		panic(err)
+		logger.Fatal("failed to diagnose host", zap.Error(err))
 	}
-	numQueries := len(queryRequest.PerChainQueries)
+	logger.Info("diagnosis complete",
+		zap.Strings("listenAddrs", diagnosis.ListenAddrs),
+		zap.String("reachability", diagnosis.Reachability),
+		zap.Bool("portMapped", diagnosis.PortMapped))
+}
 
-	// Sign the query request using our private key.
-	digest := query.QueryRequestDigest(common.MainNet, queryRequestBytes)
-	sig, err := ethCrypto.Sign(digest.Bytes(), sk)
+// runEthCallExample queries the WETH contract's name() and totalSupply()
+// at the latest block, the example this tool has always run.
+func runEthCallExample(ctx context.Context, logger *zap.Logger, qc *queryClient.Client, sk *ecdsa.PrivateKey) {
+	wethAbi, err := abi.JSON(strings.NewReader("[{\"constant\":true,\"inputs\":[],\"name\":\"name\",\"outputs\":[{\"name\":\"\",\"type\":\"string\"}],\"payable\":false,\"stateMutability\":\"view\",\"type\":\"function\"},{\"constant\":true,\"inputs\":[],\"name\":\"totalSupply\",\"outputs\":[{\"name\":\"\",\"type\":\"uint256\"}],\"payable\":false,\"stateMutability\":\"view\",\"type\":\"function\"}]"))
 	if err != nil {
 		panic(err)
 	}
 
-	signedQueryRequest := &gossipv1.SignedQueryRequest{
-		QueryRequest: queryRequestBytes,
-		Signature:    sig,
+	methods := []string{"name", "totalSupply"}
+	callData := []*query.EthCallData{}
+	to, _ := hex.DecodeString("C02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2")
+
+	for _, method := range methods {
+		data, err := wethAbi.Pack(method)
+		if err != nil {
+			panic(err)
+		}
+
+		callData = append(callData, &query.EthCallData{
+			To:   to,
+			Data: data,
+		})
+	}
+
+	// Fetch the latest block number
+	logger.Info("Querying for latest block height", zap.String("url", *ethRpcUrl))
+	blockNum, err := utils.FetchLatestBlockNumberFromUrl(ctx, *ethRpcUrl)
+	if err != nil {
+		logger.Fatal("Failed to fetch latest block number", zap.Error(err))
 	}
 
-	msg := gossipv1.GossipMessage{
-		Message: &gossipv1.GossipMessage_SignedQueryRequest{
-			SignedQueryRequest: signedQueryRequest,
-		},
+	logger.Info("latest block", zap.String("num", blockNum.String()), zap.String("encoded", hexutil.EncodeBig(blockNum)))
+
+	callRequest := &query.EthCallQueryRequest{
+		BlockId:  hexutil.EncodeBig(blockNum),
+		CallData: callData,
 	}
 
-	b, err := proto.Marshal(&msg)
+	queryRequest := createQueryRequest(callRequest)
+
+	logger.Info("submitting query", zap.String("blockNum", blockNum.String()), zap.String("publicKey", ethCrypto.PubkeyToAddress(sk.PublicKey).Hex()))
+	respCh, err := qc.SubmitQuery(ctx, queryRequest, sk)
 	if err != nil {
-		panic(err)
+		logger.Fatal("failed to submit query", zap.Error(err))
+	}
+
+	signed, ok := <-respCh
+	if !ok {
+		logger.Fatal("timed out waiting for quorum of verified responses")
 	}
+	logger.Info("quorum reached", zap.Int("numSignatures", len(signed.Signatures)))
+
+	printResults(logger, queryRequest, signed.Response, wethAbi, methods)
+}
+
+// runLogFilterExample fetches the WETH Transfer events of the last eleven
+// finalized blocks using an EthLogFilterQueryRequest, demonstrating the
+// eth_getLogs-style query type.
+func runLogFilterExample(ctx context.Context, logger *zap.Logger, qc *queryClient.Client, sk *ecdsa.PrivateKey) {
+	weth, _ := hex.DecodeString("C02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2")
 
-	err = th.Publish(ctx, b)
+	// Guardians reject a log filter whose ToBlock is beyond the finalized
+	// head, so the range ends at the finalized block, not the latest one.
+	logger.Info("Querying for finalized block height", zap.String("url", *ethRpcUrl))
+	ec, err := ethclient.DialContext(ctx, *ethRpcUrl)
 	if err != nil {
-		panic(err)
+		logger.Fatal("Failed to dial RPC", zap.Error(err))
+	}
+	header, err := ec.HeaderByNumber(ctx, big.NewInt(rpc.FinalizedBlockNumber.Int64()))
+	ec.Close()
+	if err != nil {
+		logger.Fatal("Failed to fetch finalized block number", zap.Error(err))
 	}
 
-	logger.Info("Waiting for message...")
-	// TODO: max wait time
-	// TODO: accumulate signatures to reach quorum
-	for {
-		envelope, err := sub.Next(ctx)
-		if err != nil {
-			logger.Panic("failed to receive pubsub message", zap.Error(err))
+	toBlock := header.Number
+	fromBlock := new(big.Int).Sub(toBlock, big.NewInt(10))
+	logger.Info("querying Transfer logs", zap.String("fromBlock", fromBlock.String()), zap.String("toBlock", toBlock.String()))
+
+	logFilterRequest := &query.EthLogFilterQueryRequest{
+		FromBlock: hexutil.EncodeBig(fromBlock),
+		ToBlock:   hexutil.EncodeBig(toBlock),
+		Addresses: [][]byte{weth},
+		Topics:    [][]ethCommon.Hash{{wethTransferTopic}},
+	}
+
+	queryRequest := &query.QueryRequest{
+		Nonce: rand.Uint32(),
+		PerChainQueries: []*query.PerChainQueryRequest{
+			{
+				ChainId: 2,
+				Query:   logFilterRequest,
+			},
+		},
+	}
+
+	logger.Info("submitting query", zap.String("publicKey", ethCrypto.PubkeyToAddress(sk.PublicKey).Hex()))
+	respCh, err := qc.SubmitQuery(ctx, queryRequest, sk)
+	if err != nil {
+		logger.Fatal("failed to submit query", zap.Error(err))
+	}
+
+	signed, ok := <-respCh
+	if !ok {
+		logger.Fatal("timed out waiting for quorum of verified responses")
+	}
+	logger.Info("quorum reached", zap.Int("numSignatures", len(signed.Signatures)))
+
+	logFilterResp, ok := signed.Response.PerChainResponses[0].Response.(*query.EthLogFilterQueryResponse)
+	if !ok {
+		logger.Fatal("unexpected response type for log filter query")
+	}
+
+	logger.Info("log filter result", zap.Int("numLogs", len(logFilterResp.Logs)), zap.Int("numBlockHashes", len(logFilterResp.BlockHashes)))
+	for _, l := range logFilterResp.Logs {
+		logger.Info("transfer log",
+			zap.Uint64("blockNumber", l.BlockNumber),
+			zap.String("txHash", l.TxHash.Hex()),
+			zap.String("data", hexutil.Encode(l.Data)))
+	}
+}
+
+// printResults decodes and logs the per-chain results of a verified,
+// quorum-reached query response.
+func printResults(logger *zap.Logger, queryRequest *query.QueryRequest, response *query.QueryResponsePublication, wethAbi abi.ABI, methods []string) {
+	if len(response.PerChainResponses) != len(queryRequest.PerChainQueries) {
+		logger.Warn("unexpected number of per chain query responses",
+			zap.Int("expectedNum", len(queryRequest.PerChainQueries)),
+			zap.Int("actualNum", len(response.PerChainResponses)))
+		return
+	}
+
+	for index := range response.PerChainResponses {
+		logger.Info("per chain query response index", zap.Int("index", index))
+
+		var localCallData []*query.EthCallData
+		switch ecq := queryRequest.PerChainQueries[index].Query.(type) {
+		case *query.EthCallQueryRequest:
+			localCallData = ecq.CallData
+		default:
+			panic("unsupported query type")
 		}
-		var msg gossipv1.GossipMessage
-		err = proto.Unmarshal(envelope.Data, &msg)
-		if err != nil {
-			logger.Info("received invalid message",
-				zap.Binary("data", envelope.Data),
-				zap.String("from", envelope.GetFrom().String()))
+
+		var localResp *query.EthCallQueryResponse
+		switch ecq := response.PerChainResponses[index].Response.(type) {
+		case *query.EthCallQueryResponse:
+			localResp = ecq
+		default:
+			panic("unsupported query type")
+		}
+
+		if len(localResp.Results) != len(localCallData) {
+			logger.Warn("unexpected number of results", zap.Int("expectedNum", len(localCallData)), zap.Int("actualNum", len(localResp.Results)))
 			continue
 		}
-		var isMatchingResponse bool
-		switch m := msg.Message.(type) {
-		case *gossipv1.GossipMessage_SignedQueryResponse:
-			if *targetPeerId != "" && envelope.GetFrom().String() != *targetPeerId {
-				continue
-			}
-			logger.Info("query response received",
-				zap.String("from", envelope.GetFrom().String()),
-				zap.Any("response", m.SignedQueryResponse),
-				zap.String("responseBytes", hexutil.Encode(m.SignedQueryResponse.QueryResponse)),
-				zap.String("sigBytes", hexutil.Encode(m.SignedQueryResponse.Signature)))
-			var response query.QueryResponsePublication
-			err := response.Unmarshal(m.SignedQueryResponse.QueryResponse)
+
+		for idx, resp := range localResp.Results {
+			result, err := wethAbi.Methods[methods[idx]].Outputs.Unpack(resp)
 			if err != nil {
-				logger.Warn("failed to unmarshal response", zap.Error(err))
-				break
-			}
-			if bytes.Equal(response.Request.QueryRequest, queryRequestBytes) && bytes.Equal(response.Request.Signature, sig) {
-				// TODO: verify response signature
-				isMatchingResponse = true
-
-				if len(response.PerChainResponses) != numQueries {
-					logger.Warn("unexpected number of per chain query responses", zap.Int("expectedNum", numQueries), zap.Int("actualNum", len(response.PerChainResponses)))
-					break
-				}
-				// Do double loop over responses
-				for index := range response.PerChainResponses {
-					logger.Info("per chain query response index", zap.Int("index", index))
-
-					var localCallData []*query.EthCallData
-					switch ecq := queryRequest.PerChainQueries[index].Query.(type) {
-					case *query.EthCallQueryRequest:
-						localCallData = ecq.CallData
-					default:
-						panic("unsupported query type")
-					}
-
-					var localResp *query.EthCallQueryResponse
-					switch ecq := response.PerChainResponses[index].Response.(type) {
-					case *query.EthCallQueryResponse:
-						localResp = ecq
-					default:
-						panic("unsupported query type")
-					}
-
-					if len(localResp.Results) != len(localCallData) {
-						logger.Warn("unexpected number of results", zap.Int("expectedNum", len(localCallData)), zap.Int("expectedNum", len(localResp.Results)))
-						break
-					}
-
-					for idx, resp := range localResp.Results {
-						result, err := wethAbi.Methods[methods[idx]].Outputs.Unpack(resp)
-						if err != nil {
-							logger.Warn("failed to unpack result", zap.Error(err))
-							break
-						}
-
-						resultStr := hexutil.Encode(resp)
-						logger.Info("found matching response", zap.Int("idx", idx), zap.Uint64("number", localResp.BlockNumber), zap.String("hash", localResp.Hash.String()), zap.String("time", localResp.Time.String()), zap.String("method", methods[idx]), zap.Any("resultDecoded", result), zap.String("resultStr", resultStr))
-					}
-				}
+				logger.Warn("failed to unpack result", zap.Error(err))
+				continue
 			}
-		default:
-			continue
-		}
-		if isMatchingResponse {
-			break
+
+			resultStr := hexutil.Encode(resp)
+			logger.Info("found matching response", zap.Int("idx", idx), zap.Uint64("number", localResp.BlockNumber), zap.String("hash", localResp.Hash.String()), zap.String("time", localResp.Time.String()), zap.String("method", methods[idx]), zap.Any("resultDecoded", result), zap.String("resultStr", resultStr))
 		}
 	}
 }
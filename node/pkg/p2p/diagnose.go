@@ -0,0 +1,87 @@
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/host"
+)
+
+// Diagnosis summarizes what a Host was able to learn about its own
+// reachability, for operators debugging "Waiting for peers" hangs without
+// having to read through pubsub logs.
+type Diagnosis struct {
+	// ListenAddrs are the addresses the host is actually listening/
+	// advertising on, including any port mapped by NAT traversal.
+	ListenAddrs []string
+	// Reachability is "public", "private", or "unknown", as reported by
+	// libp2p's AutoNAT subsystem.
+	Reachability string
+	// PortMapped is true if the host is advertising at least one address
+	// beyond its raw listen addresses, i.e. NATPortMap() successfully
+	// mapped a port and the external address it learned was added to the
+	// host's advertised addresses. This distinguishes "NAT traversal
+	// worked" from "the host happens to be listening on a routable
+	// address" when Reachability alone isn't conclusive yet.
+	PortMapped bool
+}
+
+// Diagnose waits up to timeout for AutoNAT to produce a reachability
+// verdict and returns a best-effort snapshot of the host's address state.
+// A verdict of "private" with no port mapped usually explains a "Waiting
+// for peers" hang: the host is reachable on its listen addresses, but
+// nothing outside the NAT can dial them.
+func Diagnose(ctx context.Context, h host.Host, timeout time.Duration) (*Diagnosis, error) {
+	sub, err := h.EventBus().Subscribe(new(event.EvtLocalReachabilityChanged))
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to reachability events: %w", err)
+	}
+	defer sub.Close()
+
+	d := &Diagnosis{Reachability: "unknown", PortMapped: hasMappedAddr(h)}
+	for _, addr := range h.Addrs() {
+		d.ListenAddrs = append(d.ListenAddrs, addr.String())
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	select {
+	case evt := <-sub.Out():
+		if reachabilityEvt, ok := evt.(event.EvtLocalReachabilityChanged); ok {
+			d.Reachability = reachabilityEvt.Reachability.String()
+		}
+	case <-waitCtx.Done():
+		// AutoNAT hasn't reached a verdict within timeout; report "unknown".
+	}
+
+	return d, nil
+}
+
+// hasMappedAddr reports whether h is advertising at least one address that
+// isn't among its listen addresses (with unspecified addresses such as
+// 0.0.0.0 expanded to the host's interface addresses, as h.Addrs() does).
+// go-libp2p's NAT manager (enabled by NATPortMap()) surfaces a successful
+// UPnP/NAT-PMP port mapping exactly this way: the external address it
+// learned gets folded into the host's advertised address set alongside (or
+// instead of) the plain listen addrs. Addresses set through
+// Components.AnnounceAddrs are not listen addresses either and count the
+// same way.
+func hasMappedAddr(h host.Host) bool {
+	ifaceAddrs, err := h.Network().InterfaceListenAddresses()
+	if err != nil {
+		return false
+	}
+	listen := make(map[string]bool, len(ifaceAddrs))
+	for _, addr := range ifaceAddrs {
+		listen[addr.String()] = true
+	}
+	for _, addr := range h.Addrs() {
+		if !listen[addr.String()] {
+			return true
+		}
+	}
+	return false
+}
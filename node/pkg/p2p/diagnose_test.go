@@ -0,0 +1,59 @@
+package p2p
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newDiagnoseTestHost builds a real, unconnected libp2p host listening only
+// on loopback, so tests can drive Diagnose without depending on any outside
+// network state.
+func newDiagnoseTestHost(t *testing.T) host.Host {
+	t.Helper()
+	h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/udp/0/quic"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = h.Close() })
+	return h
+}
+
+func TestDiagnoseReportsReachabilityEvent(t *testing.T) {
+	h := newDiagnoseTestHost(t)
+
+	emitter, err := h.EventBus().Emitter(new(event.EvtLocalReachabilityChanged))
+	require.NoError(t, err)
+	defer emitter.Close()
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		_ = emitter.Emit(event.EvtLocalReachabilityChanged{Reachability: network.ReachabilityPublic})
+	}()
+
+	d, err := Diagnose(context.Background(), h, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, network.ReachabilityPublic.String(), d.Reachability)
+	assert.NotEmpty(t, d.ListenAddrs)
+}
+
+func TestDiagnoseReportsUnknownOnTimeout(t *testing.T) {
+	h := newDiagnoseTestHost(t)
+
+	d, err := Diagnose(context.Background(), h, 20*time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, "unknown", d.Reachability)
+}
+
+func TestDiagnoseReportsNoPortMappingByDefault(t *testing.T) {
+	h := newDiagnoseTestHost(t)
+
+	d, err := Diagnose(context.Background(), h, 20*time.Millisecond)
+	require.NoError(t, err)
+	assert.False(t, d.PortMapped, "a loopback-only host has nothing mapped")
+}
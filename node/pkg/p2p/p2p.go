@@ -0,0 +1,146 @@
+// Package p2p sets up the libp2p host shared by the guardian, the CCQ
+// server, and the various hack/ test tools that need to join the guardian
+// gossip network.
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+	"go.uber.org/zap"
+)
+
+// NATPolicy selects whether a Host tries to make itself reachable from
+// behind a home router or cloud NAT.
+type NATPolicy string
+
+const (
+	// NATNone disables all automatic NAT traversal. Use this when the host
+	// has a public IP or when port mapping is configured out of band.
+	NATNone NATPolicy = "none"
+	// NATEnabled attempts traversal via go-libp2p's NATPortMap(), which
+	// probes UPnP IGD and NAT-PMP/PCP together and uses whichever protocol
+	// the router answers on. go-libp2p does not expose a way to select one
+	// protocol over the other, so there is no separate "upnp-only" or
+	// "pmp-only" policy to offer here.
+	NATEnabled NATPolicy = "enabled"
+)
+
+// ParseNATPolicy validates s against the supported NATPolicy values,
+// returning an error for anything else so a typo'd --nat flag fails fast
+// instead of silently behaving like NATEnabled.
+func ParseNATPolicy(s string) (NATPolicy, error) {
+	switch NATPolicy(s) {
+	case NATNone, NATEnabled:
+		return NATPolicy(s), nil
+	default:
+		return "", fmt.Errorf("invalid NAT policy %q: must be %q or %q", s, NATNone, NATEnabled)
+	}
+}
+
+// Components groups the host construction knobs that callers (the
+// guardian, the CCQ server, and hack/ test tools) are expected to set
+// before calling NewHost.
+type Components struct {
+	// Port is the UDP (QUIC) listener port for the p2p host.
+	Port uint
+
+	// NAT controls whether/how NewHost attempts NAT traversal so that
+	// peers behind home routers or cloud NATs can still be dialed.
+	// Defaults to NATNone.
+	NAT NATPolicy
+
+	// AnnounceAddrs, if non-empty, overrides the addresses the host
+	// advertises to peers (e.g. a known-public IP or DNS name), instead of
+	// relying solely on what libp2p discovers.
+	AnnounceAddrs []multiaddr.Multiaddr
+}
+
+// DefaultComponents returns the Components used by guardiand in
+// production: a fixed default port and no NAT traversal, since guardians
+// are expected to run with a routable address.
+func DefaultComponents() *Components {
+	return &Components{
+		Port: 8999,
+		NAT:  NATNone,
+	}
+}
+
+// NewHost creates a libp2p host listening on components.Port over QUIC,
+// applying the NAT traversal and announce-address settings in components,
+// and starts connecting it to bootstrapPeers. networkID is only logged.
+func NewHost(logger *zap.Logger, ctx context.Context, networkID string, bootstrapPeers string, components *Components, priv crypto.PrivKey) (host.Host, error) {
+	if components == nil {
+		components = DefaultComponents()
+	}
+
+	logger.Info("creating libp2p host", zap.String("networkID", networkID), zap.Uint("port", components.Port))
+
+	opts := []libp2p.Option{
+		libp2p.Identity(priv),
+		libp2p.ListenAddrStrings(
+			fmt.Sprintf("/ip4/0.0.0.0/udp/%d/quic", components.Port),
+			fmt.Sprintf("/ip6/::/udp/%d/quic", components.Port),
+		),
+		// Required for event.EvtLocalReachabilityChanged to ever fire, which
+		// is what Diagnose waits on to tell an operator whether
+		// this host is actually dialable from outside its NAT.
+		libp2p.EnableAutoNATv2(),
+	}
+
+	if components.NAT == NATEnabled {
+		logger.Info("enabling NAT traversal")
+		opts = append(opts, libp2p.NATPortMap())
+	}
+
+	if len(components.AnnounceAddrs) > 0 {
+		announce := components.AnnounceAddrs
+		logger.Info("using explicit announce addresses", zap.Any("addrs", announce))
+		opts = append(opts, libp2p.AddrsFactory(func(addrs []multiaddr.Multiaddr) []multiaddr.Multiaddr {
+			return announce
+		}))
+	}
+
+	h, err := libp2p.New(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create libp2p host: %w", err)
+	}
+
+	connectToBootstrapPeers(ctx, logger, h, bootstrapPeers)
+
+	return h, nil
+}
+
+// connectToBootstrapPeers kicks off a best-effort connection attempt to
+// every peer in the comma-separated bootstrapPeers multiaddr list.
+// Failures are logged and otherwise ignored: gossipsub peer discovery will
+// continue to find peers through whichever bootstrap nodes do answer.
+func connectToBootstrapPeers(ctx context.Context, logger *zap.Logger, h host.Host, bootstrapPeers string) {
+	for _, addr := range strings.Split(bootstrapPeers, ",") {
+		addr = strings.TrimSpace(addr)
+		if addr == "" {
+			continue
+		}
+		ma, err := multiaddr.NewMultiaddr(addr)
+		if err != nil {
+			logger.Warn("invalid bootstrap peer address", zap.String("addr", addr), zap.Error(err))
+			continue
+		}
+		info, err := peer.AddrInfoFromP2pAddr(ma)
+		if err != nil {
+			logger.Warn("invalid bootstrap peer info", zap.String("addr", addr), zap.Error(err))
+			continue
+		}
+		go func(info peer.AddrInfo) {
+			if err := h.Connect(ctx, info); err != nil {
+				logger.Debug("failed to connect to bootstrap peer", zap.String("peer", info.ID.String()), zap.Error(err))
+			}
+		}(*info)
+	}
+}
@@ -0,0 +1,26 @@
+package p2p
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultComponentsDisablesNAT(t *testing.T) {
+	c := DefaultComponents()
+	assert.Equal(t, NATNone, c.NAT)
+	assert.Equal(t, uint(8999), c.Port)
+}
+
+func TestParseNATPolicy(t *testing.T) {
+	p, err := ParseNATPolicy("none")
+	assert.NoError(t, err)
+	assert.Equal(t, NATNone, p)
+
+	p, err = ParseNATPolicy("enabled")
+	assert.NoError(t, err)
+	assert.Equal(t, NATEnabled, p)
+
+	_, err = ParseNATPolicy("upnp")
+	assert.Error(t, err, "no longer a valid policy now that fine-grained NAT protocol selection has been dropped")
+}
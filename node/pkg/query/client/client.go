@@ -0,0 +1,415 @@
+// Package client provides a reusable library for submitting cross-chain
+// query (CCQ) requests over the guardian p2p gossip network and assembling
+// a quorum of verified guardian signatures into a QueryResponsePublication
+// that is ready to be submitted on-chain.
+//
+// It replaces the ad-hoc "wait for the first response" loop that used to
+// live in node/hack/query/mainnet_test, adding max-wait-time handling,
+// signature verification against the current guardian set, and quorum
+// accumulation (2/3+1 of the guardian set, matching VAA quorum rules).
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/certusone/wormhole/node/pkg/common"
+	gossipv1 "github.com/certusone/wormhole/node/pkg/proto/gossip/v1"
+	"github.com/certusone/wormhole/node/pkg/query"
+	"github.com/certusone/wormhole/node/pkg/vaa"
+	ethCrypto "github.com/ethereum/go-ethereum/crypto"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+)
+
+// DefaultTimeout is used when Config.Timeout is left at its zero value.
+const DefaultTimeout = 2 * time.Minute
+
+// DefaultRetryInterval is used when Config.RetryInterval is zero or
+// negative.
+const DefaultRetryInterval = 15 * time.Second
+
+// IndexedSignature pairs a raw recoverable ECDSA signature with the index
+// of the guardian that produced it within the GuardianSet the response was
+// verified against. This mirrors the convention VAA signatures are packed
+// in on-chain: sorted ascending by guardian index rather than keyed by
+// address.
+type IndexedSignature struct {
+	Index     uint8
+	Signature []byte
+}
+
+// SignedResponse is a QueryResponsePublication along with the per-guardian
+// signatures that were accumulated for it. Signatures is keyed by guardian
+// index (see GuardianSet.IndexOf), not address, so it can be handed to
+// IndexedSignatures and submitted on-chain without any further lookup.
+type SignedResponse struct {
+	Response   *query.QueryResponsePublication
+	Bytes      []byte
+	Signatures map[uint8][]byte
+}
+
+// IndexedSignatures returns r.Signatures as a slice sorted ascending by
+// guardian index, ready to be packed into an on-chain submission the same
+// way a VAA's signature set is.
+func (r *SignedResponse) IndexedSignatures() []IndexedSignature {
+	out := make([]IndexedSignature, 0, len(r.Signatures))
+	for index, sig := range r.Signatures {
+		out = append(out, IndexedSignature{Index: index, Signature: sig})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Index < out[j].Index })
+	return out
+}
+
+// Config controls the behavior of a Client.
+type Config struct {
+	// Network is the guardian network the request is signed for, e.g.
+	// common.MainNet or common.TestNet.
+	Network common.Environment
+
+	// Timeout bounds how long SubmitQuery waits for quorum before it gives
+	// up and closes the response channel. Defaults to DefaultTimeout.
+	Timeout time.Duration
+
+	// RetryInterval is how often the signed request is re-published until
+	// quorum is reached or Timeout elapses. A zero or negative value is
+	// replaced by DefaultRetryInterval; re-publishing cannot be turned off.
+	RetryInterval time.Duration
+
+	// GuardianSet is used to verify that response signatures were made by
+	// current guardians and to compute the quorum threshold. It is
+	// required: responses cannot be trusted without it.
+	GuardianSet *GuardianSet
+
+	// AllowedPeer, if non-empty, restricts processed responses to gossip
+	// messages received from this libp2p peer ID.
+	AllowedPeer string
+
+	// HeadTracker, if set, is used to cross-check each response's
+	// per-chain (BlockNumber, Hash) against an independently observed
+	// finalized head before the response is accepted, per TrustPolicy.
+	HeadTracker *query.HeadTracker
+
+	// TrustPolicy controls what happens when HeadTracker disagrees with a
+	// response. Defaults to TrustPolicyOff, i.e. no cross-checking, so
+	// that HeadTracker remains opt-in.
+	TrustPolicy query.TrustPolicy
+}
+
+func (cfg *Config) setDefaults() {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = DefaultRetryInterval
+	}
+	if cfg.TrustPolicy == "" {
+		cfg.TrustPolicy = query.TrustPolicyOff
+	}
+}
+
+// publisher is the subset of *pubsub.Topic that Client needs to publish a
+// signed request, narrowed so tests can drive Client against a fake
+// publisher instead of a live libp2p network.
+type publisher interface {
+	Publish(ctx context.Context, data []byte) error
+}
+
+// envelope is the minimal information Client needs out of an incoming
+// gossip message: who sent it and its raw bytes. Depending on this instead
+// of *pubsub.Message directly keeps dispatchLoop (and its tests) decoupled
+// from go-libp2p-pubsub's wire types.
+type envelope struct {
+	from string
+	data []byte
+}
+
+// subscription is the subset of *pubsub.Subscription that Client needs to
+// read responses, narrowed so tests can drive Client against a fake
+// subscription instead of a live libp2p network.
+type subscription interface {
+	Next(ctx context.Context) (*envelope, error)
+}
+
+// pubsubPublisher adapts a real *pubsub.Topic to publisher.
+type pubsubPublisher struct {
+	topic *pubsub.Topic
+}
+
+func (p *pubsubPublisher) Publish(ctx context.Context, data []byte) error {
+	return p.topic.Publish(ctx, data)
+}
+
+// pubsubSubscription adapts a real *pubsub.Subscription to subscription.
+type pubsubSubscription struct {
+	sub *pubsub.Subscription
+}
+
+func (s *pubsubSubscription) Next(ctx context.Context) (*envelope, error) {
+	msg, err := s.sub.Next(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &envelope{from: msg.GetFrom().String(), data: msg.Data}, nil
+}
+
+// Client submits CCQ requests to the guardian p2p network and accumulates
+// signed responses into a quorum-verified SignedResponse.
+//
+// A single dispatchLoop goroutine reads c.sub for the lifetime of the
+// Client and fans incoming responses out to whichever SubmitQuery call
+// registered the matching request bytes, so SubmitQuery may safely be
+// called multiple times concurrently on the same Client: c.sub is a single
+// subscription and each message it yields is delivered to exactly one
+// reader, so per-call readers racing on it would each see only a subset of
+// the responses.
+type Client struct {
+	logger *zap.Logger
+	cfg    Config
+
+	thReq  publisher
+	thResp *pubsub.Topic
+	sub    subscription
+
+	mu       sync.Mutex
+	inFlight map[string]chan *gossipv1.SignedQueryResponse
+}
+
+// New creates a Client that publishes requests on thReq and reads responses
+// from sub (a subscription on thResp). The caller retains ownership of the
+// host, pubsub topics and subscription, and is responsible for closing them;
+// closing sub is also what stops the Client's dispatch loop.
+func New(logger *zap.Logger, thReq *pubsub.Topic, thResp *pubsub.Topic, sub *pubsub.Subscription, cfg Config) (*Client, error) {
+	if cfg.GuardianSet == nil {
+		return nil, fmt.Errorf("config must specify a guardian set")
+	}
+	cfg.setDefaults()
+	c := &Client{
+		logger:   logger,
+		cfg:      cfg,
+		thReq:    &pubsubPublisher{topic: thReq},
+		thResp:   thResp,
+		sub:      &pubsubSubscription{sub: sub},
+		inFlight: make(map[string]chan *gossipv1.SignedQueryResponse),
+	}
+	go c.dispatchLoop()
+	return c, nil
+}
+
+// SubmitQuery signs req with sk, publishes it to the guardian request topic
+// and returns a channel on which a quorum-verified SignedResponse will be
+// delivered. The channel is closed (with nothing sent) if Timeout elapses
+// before quorum is reached, or if ctx is cancelled.
+func (c *Client) SubmitQuery(ctx context.Context, req *query.QueryRequest, sk *ecdsa.PrivateKey) (<-chan SignedResponse, error) {
+	reqBytes, err := req.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal query request: %w", err)
+	}
+
+	digest := query.QueryRequestDigest(c.cfg.Network, reqBytes)
+	sig, err := ethCrypto.Sign(digest.Bytes(), sk)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign query request: %w", err)
+	}
+
+	out := make(chan SignedResponse, 1)
+
+	go c.run(ctx, reqBytes, sig, out)
+
+	return out, nil
+}
+
+func (c *Client) run(ctx context.Context, reqBytes []byte, sig []byte, out chan<- SignedResponse) {
+	defer close(out)
+
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+	defer cancel()
+
+	if err := c.publish(ctx, reqBytes, sig); err != nil {
+		c.logger.Error("failed to publish query request", zap.Error(err))
+		return
+	}
+
+	retryTicker := time.NewTicker(c.cfg.RetryInterval)
+	defer retryTicker.Stop()
+
+	// quorum is the number of distinct guardian signatures required to
+	// consider a response final, mirroring VAA quorum rules (2/3+1).
+	quorum := vaa.CalculateQuorum(len(c.cfg.GuardianSet.Addresses))
+
+	// accumulated is keyed by the raw response bytes, since all
+	// honest guardians must return byte-identical responses for the same
+	// request.
+	accumulated := make(map[string]*SignedResponse)
+
+	msgCh := c.register(reqBytes)
+	defer c.unregister(reqBytes)
+
+	for {
+		select {
+		case <-ctx.Done():
+			c.logger.Warn("timed out waiting for quorum", zap.Int("required", quorum))
+			return
+		case <-retryTicker.C:
+			if err := c.publish(ctx, reqBytes, sig); err != nil {
+				c.logger.Warn("failed to re-publish query request", zap.Error(err))
+			}
+		case sqr := <-msgCh:
+			sr, err := c.verify(sqr, reqBytes, sig)
+			if err != nil {
+				c.logger.Debug("discarding response", zap.Error(err))
+				continue
+			}
+			key := string(sr.Bytes)
+			existing, ok := accumulated[key]
+			if !ok {
+				accumulated[key] = sr
+				existing = sr
+			} else {
+				for index, s := range sr.Signatures {
+					existing.Signatures[index] = s
+				}
+			}
+			if len(existing.Signatures) >= quorum {
+				out <- *existing
+				return
+			}
+		}
+	}
+}
+
+// register claims reqBytes as the routing key for this in-flight query and
+// returns the channel dispatchLoop will deliver matching responses on. The
+// channel is buffered to the size of the guardian set so dispatchLoop never
+// blocks waiting on a slow consumer.
+func (c *Client) register(reqBytes []byte) <-chan *gossipv1.SignedQueryResponse {
+	ch := make(chan *gossipv1.SignedQueryResponse, len(c.cfg.GuardianSet.Addresses))
+	c.mu.Lock()
+	c.inFlight[string(reqBytes)] = ch
+	c.mu.Unlock()
+	return ch
+}
+
+// unregister removes the routing entry registered by register. Any response
+// that arrives for reqBytes afterwards is dropped by dispatch as unmatched.
+func (c *Client) unregister(reqBytes []byte) {
+	c.mu.Lock()
+	delete(c.inFlight, string(reqBytes))
+	c.mu.Unlock()
+}
+
+func (c *Client) publish(ctx context.Context, reqBytes []byte, sig []byte) error {
+	msg := gossipv1.GossipMessage{
+		Message: &gossipv1.GossipMessage_SignedQueryRequest{
+			SignedQueryRequest: &gossipv1.SignedQueryRequest{
+				QueryRequest: reqBytes,
+				Signature:    sig,
+			},
+		},
+	}
+	b, err := proto.Marshal(&msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal gossip message: %w", err)
+	}
+	return c.thReq.Publish(ctx, b)
+}
+
+// dispatchLoop pulls messages off the response subscription for the whole
+// lifetime of the Client and hands each SignedQueryResponse to dispatch.
+// There is exactly one of these per Client: c.sub only delivers a given
+// message to a single reader, so running more than one loop over it would
+// split incoming responses unpredictably between concurrent SubmitQuery
+// calls instead of delivering each to the call it actually answers. The
+// loop exits once the caller closes sub, per New's contract.
+func (c *Client) dispatchLoop() {
+	for {
+		env, err := c.sub.Next(context.Background())
+		if err != nil {
+			// sub.Close() (or its context being cancelled) is the expected
+			// way this loop ends.
+			return
+		}
+		if c.cfg.AllowedPeer != "" && env.from != c.cfg.AllowedPeer {
+			continue
+		}
+		var msg gossipv1.GossipMessage
+		if err := proto.Unmarshal(env.data, &msg); err != nil {
+			c.logger.Debug("received invalid gossip message", zap.Error(err))
+			continue
+		}
+		sqr, ok := msg.Message.(*gossipv1.GossipMessage_SignedQueryResponse)
+		if !ok {
+			continue
+		}
+		c.dispatch(sqr.SignedQueryResponse)
+	}
+}
+
+// dispatch routes sqr to the in-flight SubmitQuery call whose request it
+// answers, identified by the (still unverified) request bytes embedded in
+// the response. Responses for a request nobody is waiting on any more
+// (already timed out, meant for a different client, or bogus) are dropped;
+// the owning run loop re-derives and checks the same bytes again in verify.
+func (c *Client) dispatch(sqr *gossipv1.SignedQueryResponse) {
+	var response query.QueryResponsePublication
+	if err := response.Unmarshal(sqr.QueryResponse); err != nil {
+		c.logger.Debug("received unparseable query response", zap.Error(err))
+		return
+	}
+
+	c.mu.Lock()
+	ch, ok := c.inFlight[string(response.Request.QueryRequest)]
+	c.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	select {
+	case ch <- sqr:
+	default:
+		c.logger.Warn("dropping query response: in-flight query's buffer is full")
+	}
+}
+
+// verify checks that sqr is a response to our own request and that its
+// signature was made by a current member of the guardian set, returning a
+// SignedResponse with that single guardian's signature recorded.
+func (c *Client) verify(sqr *gossipv1.SignedQueryResponse, reqBytes []byte, sig []byte) (*SignedResponse, error) {
+	var response query.QueryResponsePublication
+	if err := response.Unmarshal(sqr.QueryResponse); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	if !bytes.Equal(response.Request.QueryRequest, reqBytes) || !bytes.Equal(response.Request.Signature, sig) {
+		return nil, fmt.Errorf("response does not match our request")
+	}
+
+	digest := query.QueryResponseDigest(c.cfg.Network, sqr.QueryResponse)
+	pubKey, err := ethCrypto.SigToPub(digest.Bytes(), sqr.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("failed to recover signer: %w", err)
+	}
+	addr := ethCrypto.PubkeyToAddress(*pubKey)
+	index, ok := c.cfg.GuardianSet.IndexOf(addr)
+	if !ok {
+		return nil, fmt.Errorf("response signed by %s, which is not in the current guardian set", addr.Hex())
+	}
+
+	if err := c.checkAgainstHeadTracker(&response); err != nil {
+		return nil, err
+	}
+
+	return &SignedResponse{
+		Response: &response,
+		Bytes:    sqr.QueryResponse,
+		Signatures: map[uint8][]byte{
+			index: sqr.Signature,
+		},
+	}, nil
+}
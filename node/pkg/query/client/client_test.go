@@ -0,0 +1,330 @@
+package client
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"testing"
+	"time"
+
+	"github.com/certusone/wormhole/node/pkg/common"
+	gossipv1 "github.com/certusone/wormhole/node/pkg/proto/gossip/v1"
+	"github.com/certusone/wormhole/node/pkg/query"
+	ethCommon "github.com/ethereum/go-ethereum/common"
+	ethCrypto "github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+)
+
+// fakePublisher discards everything published to it: these tests drive
+// responses directly onto a fakeSubscription instead of round-tripping
+// through a real request topic.
+type fakePublisher struct{}
+
+func (fakePublisher) Publish(ctx context.Context, data []byte) error { return nil }
+
+// fakeSubscription feeds pre-built envelopes to a Client's dispatch loop,
+// standing in for a live pubsub.Subscription.
+type fakeSubscription struct {
+	ch chan *envelope
+}
+
+func newFakeSubscription() *fakeSubscription {
+	return &fakeSubscription{ch: make(chan *envelope, 16)}
+}
+
+func (s *fakeSubscription) push(env *envelope) {
+	s.ch <- env
+}
+
+func (s *fakeSubscription) Next(ctx context.Context) (*envelope, error) {
+	select {
+	case env := <-s.ch:
+		return env, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// testGuardian is a guardian keypair plus its recovered address, used to
+// sign fake responses.
+type testGuardian struct {
+	key  *ecdsa.PrivateKey
+	addr ethCommon.Address
+}
+
+func newTestGuardians(t *testing.T, n int) []testGuardian {
+	t.Helper()
+	guardians := make([]testGuardian, n)
+	for i := range guardians {
+		key, err := ethCrypto.GenerateKey()
+		require.NoError(t, err)
+		guardians[i] = testGuardian{key: key, addr: ethCrypto.PubkeyToAddress(key.PublicKey)}
+	}
+	return guardians
+}
+
+// newTestClient builds a Client wired to a fakeSubscription with its
+// dispatch loop already running, so tests can push responses and call
+// SubmitQuery without a live libp2p network.
+func newTestClient(t *testing.T, cfg Config) (*Client, *fakeSubscription) {
+	t.Helper()
+	cfg.setDefaults()
+	sub := newFakeSubscription()
+	c := &Client{
+		logger:   zap.NewNop(),
+		cfg:      cfg,
+		thReq:    fakePublisher{},
+		sub:      sub,
+		inFlight: make(map[string]chan *gossipv1.SignedQueryResponse),
+	}
+	go c.dispatchLoop()
+	return c, sub
+}
+
+// signedResponseEnvelope builds the gossip envelope a guardian would
+// publish in answer to (reqBytes, reqSig): an empty QueryResponsePublication
+// echoing the request and signed by guardian. Tests all use the zero-value
+// Config.Network (the default common.Environment), matching newTestClient.
+func signedResponseEnvelope(t *testing.T, reqBytes, reqSig []byte, guardian testGuardian) *envelope {
+	t.Helper()
+
+	resp := &query.QueryResponsePublication{
+		Request: query.SignedQueryRequest{QueryRequest: reqBytes, Signature: reqSig},
+	}
+	respBytes, err := resp.Marshal()
+	require.NoError(t, err)
+
+	digest := query.QueryResponseDigest(common.Environment(""), respBytes)
+	sig, err := ethCrypto.Sign(digest.Bytes(), guardian.key)
+	require.NoError(t, err)
+
+	sqr := &gossipv1.SignedQueryResponse{QueryResponse: respBytes, Signature: sig}
+	gm := &gossipv1.GossipMessage{Message: &gossipv1.GossipMessage_SignedQueryResponse{SignedQueryResponse: sqr}}
+	data, err := proto.Marshal(gm)
+	require.NoError(t, err)
+
+	return &envelope{from: "guardian-peer", data: data}
+}
+
+// waitForRegistration blocks until c.run has registered reqBytes as an
+// in-flight query, so tests don't race dispatch against SubmitQuery's
+// goroutine scheduling before pushing a response onto the fake subscription.
+func waitForRegistration(t *testing.T, c *Client, reqBytes []byte) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		c.mu.Lock()
+		_, ok := c.inFlight[string(reqBytes)]
+		c.mu.Unlock()
+		if ok {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for query registration")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// signAndMarshalRequest signs req the same way SubmitQuery does, so tests
+// can build matching fake responses without SubmitQuery exposing reqBytes
+// and sig itself.
+func signAndMarshalRequest(t *testing.T, req *query.QueryRequest, sk *ecdsa.PrivateKey) (reqBytes, sig []byte) {
+	t.Helper()
+	reqBytes, err := req.Marshal()
+	require.NoError(t, err)
+	digest := query.QueryRequestDigest(common.Environment(""), reqBytes)
+	sig, err = ethCrypto.Sign(digest.Bytes(), sk)
+	require.NoError(t, err)
+	return reqBytes, sig
+}
+
+func TestRunReachesQuorumAcrossDistinctSigners(t *testing.T) {
+	guardians := newTestGuardians(t, 4)
+	gs := &GuardianSet{Addresses: []ethCommon.Address{guardians[0].addr, guardians[1].addr, guardians[2].addr, guardians[3].addr}}
+
+	c, sub := newTestClient(t, Config{
+		GuardianSet:   gs,
+		Timeout:       5 * time.Second,
+		RetryInterval: time.Minute,
+	})
+
+	sk, err := ethCrypto.GenerateKey()
+	require.NoError(t, err)
+	req := &query.QueryRequest{Nonce: 1}
+
+	out, err := c.SubmitQuery(context.Background(), req, sk)
+	require.NoError(t, err)
+
+	reqBytes, reqSig := signAndMarshalRequest(t, req, sk)
+	waitForRegistration(t, c, reqBytes)
+
+	// quorum for 4 guardians is 3: two signers are not enough...
+	sub.push(signedResponseEnvelope(t, reqBytes, reqSig, guardians[0]))
+	sub.push(signedResponseEnvelope(t, reqBytes, reqSig, guardians[1]))
+
+	select {
+	case resp := <-out:
+		t.Fatalf("quorum reached with only 2 of 4 signatures: %+v", resp)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// ...but a third distinct signer is.
+	sub.push(signedResponseEnvelope(t, reqBytes, reqSig, guardians[2]))
+
+	select {
+	case resp, ok := <-out:
+		require.True(t, ok)
+		assert.Len(t, resp.Signatures, 3)
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for quorum")
+	}
+}
+
+func TestRunDedupsRepeatSigner(t *testing.T) {
+	guardians := newTestGuardians(t, 4)
+	gs := &GuardianSet{Addresses: []ethCommon.Address{guardians[0].addr, guardians[1].addr, guardians[2].addr, guardians[3].addr}}
+
+	c, sub := newTestClient(t, Config{
+		GuardianSet:   gs,
+		Timeout:       200 * time.Millisecond,
+		RetryInterval: time.Minute,
+	})
+
+	sk, err := ethCrypto.GenerateKey()
+	require.NoError(t, err)
+	req := &query.QueryRequest{Nonce: 2}
+
+	out, err := c.SubmitQuery(context.Background(), req, sk)
+	require.NoError(t, err)
+
+	reqBytes, reqSig := signAndMarshalRequest(t, req, sk)
+	waitForRegistration(t, c, reqBytes)
+
+	// The same guardian signing twice only ever counts once towards quorum.
+	sub.push(signedResponseEnvelope(t, reqBytes, reqSig, guardians[0]))
+	sub.push(signedResponseEnvelope(t, reqBytes, reqSig, guardians[0]))
+
+	select {
+	case resp, ok := <-out:
+		assert.False(t, ok, "unexpected response before timeout: %+v", resp)
+	case <-time.After(time.Second):
+		t.Fatal("channel neither closed nor delivered a response")
+	}
+}
+
+func TestRunRejectsNonGuardianSigner(t *testing.T) {
+	guardians := newTestGuardians(t, 4)
+	outsider := newTestGuardians(t, 1)[0]
+	gs := &GuardianSet{Addresses: []ethCommon.Address{guardians[0].addr, guardians[1].addr, guardians[2].addr, guardians[3].addr}}
+
+	c, sub := newTestClient(t, Config{
+		GuardianSet:   gs,
+		Timeout:       200 * time.Millisecond,
+		RetryInterval: time.Minute,
+	})
+
+	sk, err := ethCrypto.GenerateKey()
+	require.NoError(t, err)
+	req := &query.QueryRequest{Nonce: 3}
+
+	out, err := c.SubmitQuery(context.Background(), req, sk)
+	require.NoError(t, err)
+
+	reqBytes, reqSig := signAndMarshalRequest(t, req, sk)
+	waitForRegistration(t, c, reqBytes)
+
+	sub.push(signedResponseEnvelope(t, reqBytes, reqSig, outsider))
+
+	select {
+	case resp, ok := <-out:
+		assert.False(t, ok, "response signed by a non-guardian should have been discarded: %+v", resp)
+	case <-time.After(time.Second):
+		t.Fatal("channel neither closed nor delivered a response")
+	}
+}
+
+func TestRunTimesOutWithoutQuorum(t *testing.T) {
+	guardians := newTestGuardians(t, 4)
+	gs := &GuardianSet{Addresses: []ethCommon.Address{guardians[0].addr, guardians[1].addr, guardians[2].addr, guardians[3].addr}}
+
+	c, _ := newTestClient(t, Config{
+		GuardianSet:   gs,
+		Timeout:       50 * time.Millisecond,
+		RetryInterval: time.Minute,
+	})
+
+	sk, err := ethCrypto.GenerateKey()
+	require.NoError(t, err)
+	req := &query.QueryRequest{Nonce: 4}
+
+	out, err := c.SubmitQuery(context.Background(), req, sk)
+	require.NoError(t, err)
+
+	select {
+	case resp, ok := <-out:
+		assert.False(t, ok, "expected the channel to close without a response: %+v", resp)
+	case <-time.After(time.Second):
+		t.Fatal("SubmitQuery did not time out")
+	}
+}
+
+func TestVerifyRejectsRequestBytesMismatch(t *testing.T) {
+	guardians := newTestGuardians(t, 1)
+	gs := &GuardianSet{Addresses: []ethCommon.Address{guardians[0].addr}}
+	c := &Client{logger: zap.NewNop(), cfg: Config{GuardianSet: gs}}
+
+	sk, err := ethCrypto.GenerateKey()
+	require.NoError(t, err)
+	req := &query.QueryRequest{Nonce: 5}
+	reqBytes, reqSig := signAndMarshalRequest(t, req, sk)
+
+	env := signedResponseEnvelope(t, reqBytes, reqSig, guardians[0])
+	var msg gossipv1.GossipMessage
+	require.NoError(t, proto.Unmarshal(env.data, &msg))
+	sqr := msg.Message.(*gossipv1.GossipMessage_SignedQueryResponse).SignedQueryResponse
+
+	_, err = c.verify(sqr, []byte("some other request bytes"), reqSig)
+	assert.Error(t, err)
+}
+
+func TestVerifyRejectsSignatureMismatch(t *testing.T) {
+	guardians := newTestGuardians(t, 1)
+	gs := &GuardianSet{Addresses: []ethCommon.Address{guardians[0].addr}}
+	c := &Client{logger: zap.NewNop(), cfg: Config{GuardianSet: gs}}
+
+	sk, err := ethCrypto.GenerateKey()
+	require.NoError(t, err)
+	req := &query.QueryRequest{Nonce: 6}
+	reqBytes, reqSig := signAndMarshalRequest(t, req, sk)
+
+	env := signedResponseEnvelope(t, reqBytes, reqSig, guardians[0])
+	var msg gossipv1.GossipMessage
+	require.NoError(t, proto.Unmarshal(env.data, &msg))
+	sqr := msg.Message.(*gossipv1.GossipMessage_SignedQueryResponse).SignedQueryResponse
+
+	_, err = c.verify(sqr, reqBytes, []byte("some other signature"))
+	assert.Error(t, err)
+}
+
+func TestVerifyReturnsSignerGuardianIndex(t *testing.T) {
+	guardians := newTestGuardians(t, 3)
+	gs := &GuardianSet{Addresses: []ethCommon.Address{guardians[0].addr, guardians[1].addr, guardians[2].addr}}
+	c := &Client{logger: zap.NewNop(), cfg: Config{GuardianSet: gs}}
+
+	sk, err := ethCrypto.GenerateKey()
+	require.NoError(t, err)
+	req := &query.QueryRequest{Nonce: 7}
+	reqBytes, reqSig := signAndMarshalRequest(t, req, sk)
+
+	env := signedResponseEnvelope(t, reqBytes, reqSig, guardians[1])
+	var msg gossipv1.GossipMessage
+	require.NoError(t, proto.Unmarshal(env.data, &msg))
+	sqr := msg.Message.(*gossipv1.GossipMessage_SignedQueryResponse).SignedQueryResponse
+
+	sr, err := c.verify(sqr, reqBytes, reqSig)
+	require.NoError(t, err)
+	assert.Equal(t, []byte(sqr.Signature), sr.Signatures[1])
+}
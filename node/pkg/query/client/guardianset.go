@@ -0,0 +1,85 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	ethAbi "github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	ethCommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// coreBridgeABI is the minimal ABI needed to read the current guardian set
+// off of a Wormhole core contract.
+const coreBridgeABI = `[
+	{"constant":true,"inputs":[],"name":"getCurrentGuardianSetIndex","outputs":[{"name":"","type":"uint32"}],"payable":false,"stateMutability":"view","type":"function"},
+	{"constant":true,"inputs":[{"name":"index","type":"uint32"}],"name":"getGuardianSet","outputs":[{"components":[{"name":"keys","type":"address[]"},{"name":"expirationTime","type":"uint32"}],"name":"","type":"tuple"}],"payable":false,"stateMutability":"view","type":"function"}
+]`
+
+// GuardianSet is the subset of the on-chain guardian set that the client
+// needs in order to verify per-guardian signatures and to compute quorum.
+type GuardianSet struct {
+	Index     uint32
+	Addresses []ethCommon.Address
+}
+
+// Contains returns true if addr is a member of the guardian set.
+func (gs *GuardianSet) Contains(addr ethCommon.Address) bool {
+	_, ok := gs.IndexOf(addr)
+	return ok
+}
+
+// IndexOf returns the position of addr within the guardian set and true, or
+// (0, false) if addr is not a member. The index matches the convention VAA
+// signatures are packed with, so callers can tag a recovered signature for
+// on-chain verification without re-deriving it elsewhere.
+func (gs *GuardianSet) IndexOf(addr ethCommon.Address) (uint8, bool) {
+	for i, a := range gs.Addresses {
+		if a == addr {
+			return uint8(i), true
+		}
+	}
+	return 0, false
+}
+
+// FetchGuardianSetFromEVM reads the current guardian set from the Wormhole
+// core contract at coreContractAddr, using the EVM JSON-RPC endpoint at
+// rpcURL. This is used to verify guardian signatures on query responses
+// without having to trust a third party for the guardian set.
+func FetchGuardianSetFromEVM(ctx context.Context, rpcURL string, coreContractAddr ethCommon.Address) (*GuardianSet, error) {
+	ec, err := ethclient.DialContext(ctx, rpcURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial %s: %w", rpcURL, err)
+	}
+	defer ec.Close()
+
+	parsedAbi, err := ethAbi.JSON(strings.NewReader(coreBridgeABI))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse core bridge abi: %w", err)
+	}
+
+	contract := bind.NewBoundContract(coreContractAddr, parsedAbi, ec, ec, ec)
+	opts := &bind.CallOpts{Context: ctx}
+
+	var indexResult []interface{}
+	if err := contract.Call(opts, &indexResult, "getCurrentGuardianSetIndex"); err != nil {
+		return nil, fmt.Errorf("failed to get current guardian set index: %w", err)
+	}
+	index := *ethAbi.ConvertType(indexResult[0], new(uint32)).(*uint32)
+
+	var setResult []interface{}
+	if err := contract.Call(opts, &setResult, "getGuardianSet", index); err != nil {
+		return nil, fmt.Errorf("failed to get guardian set %d: %w", index, err)
+	}
+	set := *ethAbi.ConvertType(setResult[0], new(struct {
+		Keys           []ethCommon.Address
+		ExpirationTime uint32
+	})).(*struct {
+		Keys           []ethCommon.Address
+		ExpirationTime uint32
+	})
+
+	return &GuardianSet{Index: index, Addresses: set.Keys}, nil
+}
@@ -0,0 +1,39 @@
+package client
+
+import (
+	"testing"
+
+	ethCommon "github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGuardianSetContains(t *testing.T) {
+	a := ethCommon.HexToAddress("0x1111111111111111111111111111111111111111")
+	b := ethCommon.HexToAddress("0x2222222222222222222222222222222222222222")
+	other := ethCommon.HexToAddress("0x3333333333333333333333333333333333333333")
+
+	gs := &GuardianSet{Index: 4, Addresses: []ethCommon.Address{a, b}}
+
+	assert.True(t, gs.Contains(a))
+	assert.True(t, gs.Contains(b))
+	assert.False(t, gs.Contains(other))
+}
+
+func TestGuardianSetIndexOf(t *testing.T) {
+	a := ethCommon.HexToAddress("0x1111111111111111111111111111111111111111")
+	b := ethCommon.HexToAddress("0x2222222222222222222222222222222222222222")
+	other := ethCommon.HexToAddress("0x3333333333333333333333333333333333333333")
+
+	gs := &GuardianSet{Index: 4, Addresses: []ethCommon.Address{a, b}}
+
+	index, ok := gs.IndexOf(a)
+	assert.True(t, ok)
+	assert.Equal(t, uint8(0), index)
+
+	index, ok = gs.IndexOf(b)
+	assert.True(t, ok)
+	assert.Equal(t, uint8(1), index)
+
+	_, ok = gs.IndexOf(other)
+	assert.False(t, ok)
+}
@@ -0,0 +1,62 @@
+package client
+
+import (
+	"fmt"
+
+	"github.com/certusone/wormhole/node/pkg/query"
+	ethCommon "github.com/ethereum/go-ethereum/common"
+)
+
+// checkAgainstHeadTracker cross-checks every per-chain response in r
+// against cfg.HeadTracker's own view of the chain, per cfg.TrustPolicy. It
+// is a no-op when no HeadTracker is configured or TrustPolicy is "off".
+func (c *Client) checkAgainstHeadTracker(r *query.QueryResponsePublication) error {
+	if c.cfg.HeadTracker == nil || c.cfg.TrustPolicy == query.TrustPolicyOff {
+		return nil
+	}
+
+	for _, pcr := range r.PerChainResponses {
+		for _, claim := range headClaims(pcr) {
+			matches, known := c.cfg.HeadTracker.Verify(pcr.ChainId, claim.number, claim.hash)
+			if !known {
+				continue
+			}
+			if matches {
+				continue
+			}
+
+			msg := fmt.Sprintf("response for chain %d claims block %d has hash %s, but the local head tracker disagrees",
+				pcr.ChainId, claim.number, claim.hash.Hex())
+			switch c.cfg.TrustPolicy {
+			case query.TrustPolicyStrict:
+				return fmt.Errorf("%s", msg)
+			case query.TrustPolicyWarn:
+				c.logger.Warn(msg)
+			}
+		}
+	}
+
+	return nil
+}
+
+type headClaim struct {
+	number uint64
+	hash   ethCommon.Hash
+}
+
+// headClaims extracts every (BlockNumber, Hash) pair a per-chain response
+// asserts, so they can be checked against a HeadTracker.
+func headClaims(pcr *query.PerChainQueryResponse) []headClaim {
+	switch resp := pcr.Response.(type) {
+	case *query.EthCallQueryResponse:
+		return []headClaim{{number: resp.BlockNumber, hash: resp.Hash}}
+	case *query.EthLogFilterQueryResponse:
+		claims := make([]headClaim, 0, len(resp.BlockHashes))
+		for i, hash := range resp.BlockHashes {
+			claims = append(claims, headClaim{number: resp.FromBlock + uint64(i), hash: hash})
+		}
+		return claims
+	default:
+		return nil
+	}
+}
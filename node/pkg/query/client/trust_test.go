@@ -0,0 +1,70 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/certusone/wormhole/node/pkg/query"
+	ethCommon "github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestCheckAgainstHeadTrackerOffByDefault(t *testing.T) {
+	tracker := query.NewHeadTracker(zap.NewNop(), nil, 4)
+	tracker.Record(2, 100, ethCommon.HexToHash("0xgood"))
+
+	// No TrustPolicy is set: setDefaults must leave cross-checking off even
+	// though a HeadTracker is configured and disagrees with the response.
+	cfg := Config{HeadTracker: tracker}
+	cfg.setDefaults()
+	c := &Client{logger: zap.NewNop(), cfg: cfg}
+	resp := &query.QueryResponsePublication{
+		PerChainResponses: []*query.PerChainQueryResponse{
+			{ChainId: 2, Response: &query.EthCallQueryResponse{BlockNumber: 100, Hash: ethCommon.HexToHash("0xbad")}},
+		},
+	}
+	require.NoError(t, c.checkAgainstHeadTracker(resp))
+}
+
+func TestCheckAgainstHeadTrackerStrictRejectsMismatch(t *testing.T) {
+	tracker := query.NewHeadTracker(zap.NewNop(), nil, 4)
+	tracker.Record(2, 100, ethCommon.HexToHash("0xgood"))
+
+	c := &Client{logger: zap.NewNop(), cfg: Config{TrustPolicy: query.TrustPolicyStrict, HeadTracker: tracker}}
+	resp := &query.QueryResponsePublication{
+		PerChainResponses: []*query.PerChainQueryResponse{
+			{ChainId: 2, Response: &query.EthCallQueryResponse{BlockNumber: 100, Hash: ethCommon.HexToHash("0xbad")}},
+		},
+	}
+
+	assert.Error(t, c.checkAgainstHeadTracker(resp))
+}
+
+func TestCheckAgainstHeadTrackerWarnAcceptsMismatch(t *testing.T) {
+	tracker := query.NewHeadTracker(zap.NewNop(), nil, 4)
+	tracker.Record(2, 100, ethCommon.HexToHash("0xgood"))
+
+	c := &Client{logger: zap.NewNop(), cfg: Config{TrustPolicy: query.TrustPolicyWarn, HeadTracker: tracker}}
+	resp := &query.QueryResponsePublication{
+		PerChainResponses: []*query.PerChainQueryResponse{
+			{ChainId: 2, Response: &query.EthCallQueryResponse{BlockNumber: 100, Hash: ethCommon.HexToHash("0xbad")}},
+		},
+	}
+
+	assert.NoError(t, c.checkAgainstHeadTracker(resp))
+}
+
+func TestCheckAgainstHeadTrackerAcceptsMatch(t *testing.T) {
+	tracker := query.NewHeadTracker(zap.NewNop(), nil, 4)
+	tracker.Record(2, 100, ethCommon.HexToHash("0xgood"))
+
+	c := &Client{logger: zap.NewNop(), cfg: Config{TrustPolicy: query.TrustPolicyStrict, HeadTracker: tracker}}
+	resp := &query.QueryResponsePublication{
+		PerChainResponses: []*query.PerChainQueryResponse{
+			{ChainId: 2, Response: &query.EthCallQueryResponse{BlockNumber: 100, Hash: ethCommon.HexToHash("0xgood")}},
+		},
+	}
+
+	assert.NoError(t, c.checkAgainstHeadTracker(resp))
+}
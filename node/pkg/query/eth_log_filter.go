@@ -0,0 +1,296 @@
+package query
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	ethCommon "github.com/ethereum/go-ethereum/common"
+)
+
+// EthLogFilterQueryRequest fetches historical logs matching an
+// eth_getLogs-style filter over a fixed, already-known block range.
+// FromBlock/ToBlock follow the same string encoding as
+// EthCallQueryRequest.BlockId (e.g. "0x1234567" or "latest"/"finalized").
+// Topics mirrors the eth_getLogs topics parameter: Topics[i] is the set of
+// values that may match position i (an OR), and a nil/empty entry means
+// "any value" at that position.
+type EthLogFilterQueryRequest struct {
+	FromBlock string
+	ToBlock   string
+	Addresses [][]byte
+	Topics    [][]ethCommon.Hash
+}
+
+func (q *EthLogFilterQueryRequest) Type() QueryType { return QueryTypeEthLogFilter }
+
+func (q *EthLogFilterQueryRequest) Marshal() ([]byte, error) {
+	buf := new(bytes.Buffer)
+
+	if err := writeString(buf, q.FromBlock); err != nil {
+		return nil, err
+	}
+	if err := writeString(buf, q.ToBlock); err != nil {
+		return nil, err
+	}
+
+	if len(q.Addresses) > 255 {
+		return nil, fmt.Errorf("too many addresses: %d", len(q.Addresses))
+	}
+	buf.WriteByte(uint8(len(q.Addresses)))
+	for _, addr := range q.Addresses {
+		binary.Write(buf, binary.BigEndian, uint32(len(addr))) //nolint:errcheck
+		buf.Write(addr)
+	}
+
+	if len(q.Topics) > 255 {
+		return nil, fmt.Errorf("too many topic positions: %d", len(q.Topics))
+	}
+	buf.WriteByte(uint8(len(q.Topics)))
+	for _, position := range q.Topics {
+		if len(position) > 255 {
+			return nil, fmt.Errorf("too many topics at one position: %d", len(position))
+		}
+		buf.WriteByte(uint8(len(position)))
+		for _, topic := range position {
+			buf.Write(topic.Bytes())
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (q *EthLogFilterQueryRequest) Unmarshal(data []byte) error {
+	reader := bytes.NewReader(data)
+
+	fromBlock, err := readString(reader)
+	if err != nil {
+		return fmt.Errorf("failed to read from block: %w", err)
+	}
+	q.FromBlock = fromBlock
+
+	toBlock, err := readString(reader)
+	if err != nil {
+		return fmt.Errorf("failed to read to block: %w", err)
+	}
+	q.ToBlock = toBlock
+
+	numAddrs, err := reader.ReadByte()
+	if err != nil {
+		return fmt.Errorf("failed to read number of addresses: %w", err)
+	}
+	q.Addresses = make([][]byte, 0, numAddrs)
+	for i := 0; i < int(numAddrs); i++ {
+		var length uint32
+		if err := binary.Read(reader, binary.BigEndian, &length); err != nil {
+			return fmt.Errorf("failed to read address length: %w", err)
+		}
+		addr, err := readBytes(reader, int(length))
+		if err != nil {
+			return fmt.Errorf("failed to read address: %w", err)
+		}
+		q.Addresses = append(q.Addresses, addr)
+	}
+
+	numPositions, err := reader.ReadByte()
+	if err != nil {
+		return fmt.Errorf("failed to read number of topic positions: %w", err)
+	}
+	q.Topics = make([][]ethCommon.Hash, 0, numPositions)
+	for i := 0; i < int(numPositions); i++ {
+		numTopics, err := reader.ReadByte()
+		if err != nil {
+			return fmt.Errorf("failed to read number of topics at position %d: %w", i, err)
+		}
+		// An empty position decodes as nil ("any value"), so a request
+		// whose empty positions are nil round-trips unchanged.
+		var topics []ethCommon.Hash
+		if numTopics > 0 {
+			topics = make([]ethCommon.Hash, 0, numTopics)
+		}
+		for j := 0; j < int(numTopics); j++ {
+			hashBytes, err := readBytes(reader, ethCommon.HashLength)
+			if err != nil {
+				return fmt.Errorf("failed to read topic %d at position %d: %w", j, i, err)
+			}
+			topics = append(topics, ethCommon.BytesToHash(hashBytes))
+		}
+		q.Topics = append(q.Topics, topics)
+	}
+
+	return nil
+}
+
+// EthLog is a single matched log entry, in the same shape as an EVM
+// eth_getLogs result.
+type EthLog struct {
+	Address     []byte
+	Topics      []ethCommon.Hash
+	Data        []byte
+	BlockNumber uint64
+	BlockHash   ethCommon.Hash
+	TxHash      ethCommon.Hash
+	TxIndex     uint32
+	LogIndex    uint32
+}
+
+// EthLogFilterQueryResponse is the result of running an
+// EthLogFilterQueryRequest. BlockHashes carries the canonical hash of every
+// block in [FromBlock, ToBlock] so that guardians answering from different
+// RPC providers can be compared for quorum even if Logs happens to be
+// empty, and so that a requester can detect a reorg between guardians.
+type EthLogFilterQueryResponse struct {
+	FromBlock   uint64
+	ToBlock     uint64
+	BlockHashes []ethCommon.Hash
+	Logs        []*EthLog
+}
+
+func (r *EthLogFilterQueryResponse) Type() QueryType { return QueryTypeEthLogFilter }
+
+func (r *EthLogFilterQueryResponse) Marshal() ([]byte, error) {
+	buf := new(bytes.Buffer)
+
+	binary.Write(buf, binary.BigEndian, r.FromBlock) //nolint:errcheck
+	binary.Write(buf, binary.BigEndian, r.ToBlock)   //nolint:errcheck
+
+	binary.Write(buf, binary.BigEndian, uint32(len(r.BlockHashes))) //nolint:errcheck
+	for _, h := range r.BlockHashes {
+		buf.Write(h.Bytes())
+	}
+
+	binary.Write(buf, binary.BigEndian, uint32(len(r.Logs))) //nolint:errcheck
+	for _, l := range r.Logs {
+		binary.Write(buf, binary.BigEndian, uint32(len(l.Address))) //nolint:errcheck
+		buf.Write(l.Address)
+
+		buf.WriteByte(uint8(len(l.Topics)))
+		for _, t := range l.Topics {
+			buf.Write(t.Bytes())
+		}
+
+		binary.Write(buf, binary.BigEndian, uint32(len(l.Data))) //nolint:errcheck
+		buf.Write(l.Data)
+
+		binary.Write(buf, binary.BigEndian, l.BlockNumber) //nolint:errcheck
+		buf.Write(l.BlockHash.Bytes())
+		buf.Write(l.TxHash.Bytes())
+		binary.Write(buf, binary.BigEndian, l.TxIndex)  //nolint:errcheck
+		binary.Write(buf, binary.BigEndian, l.LogIndex) //nolint:errcheck
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (r *EthLogFilterQueryResponse) Unmarshal(data []byte) error {
+	reader := bytes.NewReader(data)
+
+	if err := binary.Read(reader, binary.BigEndian, &r.FromBlock); err != nil {
+		return fmt.Errorf("failed to read from block: %w", err)
+	}
+	if err := binary.Read(reader, binary.BigEndian, &r.ToBlock); err != nil {
+		return fmt.Errorf("failed to read to block: %w", err)
+	}
+
+	var numHashes uint32
+	if err := binary.Read(reader, binary.BigEndian, &numHashes); err != nil {
+		return fmt.Errorf("failed to read number of block hashes: %w", err)
+	}
+	r.BlockHashes = make([]ethCommon.Hash, 0, numHashes)
+	for i := uint32(0); i < numHashes; i++ {
+		hashBytes, err := readBytes(reader, ethCommon.HashLength)
+		if err != nil {
+			return fmt.Errorf("failed to read block hash %d: %w", i, err)
+		}
+		r.BlockHashes = append(r.BlockHashes, ethCommon.BytesToHash(hashBytes))
+	}
+
+	var numLogs uint32
+	if err := binary.Read(reader, binary.BigEndian, &numLogs); err != nil {
+		return fmt.Errorf("failed to read number of logs: %w", err)
+	}
+	r.Logs = make([]*EthLog, 0, numLogs)
+	for i := uint32(0); i < numLogs; i++ {
+		l := &EthLog{}
+
+		var addrLen uint32
+		if err := binary.Read(reader, binary.BigEndian, &addrLen); err != nil {
+			return fmt.Errorf("failed to read log %d address length: %w", i, err)
+		}
+		addrBytes, err := readBytes(reader, int(addrLen))
+		if err != nil {
+			return fmt.Errorf("failed to read log %d address: %w", i, err)
+		}
+		l.Address = addrBytes
+
+		numTopics, err := reader.ReadByte()
+		if err != nil {
+			return fmt.Errorf("failed to read log %d topic count: %w", i, err)
+		}
+		l.Topics = make([]ethCommon.Hash, 0, numTopics)
+		for j := 0; j < int(numTopics); j++ {
+			hashBytes, err := readBytes(reader, ethCommon.HashLength)
+			if err != nil {
+				return fmt.Errorf("failed to read log %d topic %d: %w", i, j, err)
+			}
+			l.Topics = append(l.Topics, ethCommon.BytesToHash(hashBytes))
+		}
+
+		var dataLen uint32
+		if err := binary.Read(reader, binary.BigEndian, &dataLen); err != nil {
+			return fmt.Errorf("failed to read log %d data length: %w", i, err)
+		}
+		logData, err := readBytes(reader, int(dataLen))
+		if err != nil {
+			return fmt.Errorf("failed to read log %d data: %w", i, err)
+		}
+		l.Data = logData
+
+		if err := binary.Read(reader, binary.BigEndian, &l.BlockNumber); err != nil {
+			return fmt.Errorf("failed to read log %d block number: %w", i, err)
+		}
+		blockHashBytes, err := readBytes(reader, ethCommon.HashLength)
+		if err != nil {
+			return fmt.Errorf("failed to read log %d block hash: %w", i, err)
+		}
+		l.BlockHash = ethCommon.BytesToHash(blockHashBytes)
+
+		txHashBytes, err := readBytes(reader, ethCommon.HashLength)
+		if err != nil {
+			return fmt.Errorf("failed to read log %d tx hash: %w", i, err)
+		}
+		l.TxHash = ethCommon.BytesToHash(txHashBytes)
+
+		if err := binary.Read(reader, binary.BigEndian, &l.TxIndex); err != nil {
+			return fmt.Errorf("failed to read log %d tx index: %w", i, err)
+		}
+		if err := binary.Read(reader, binary.BigEndian, &l.LogIndex); err != nil {
+			return fmt.Errorf("failed to read log %d log index: %w", i, err)
+		}
+
+		r.Logs = append(r.Logs, l)
+	}
+
+	return nil
+}
+
+func writeString(buf *bytes.Buffer, s string) error {
+	if len(s) > 1<<16-1 {
+		return fmt.Errorf("string too long: %d bytes", len(s))
+	}
+	binary.Write(buf, binary.BigEndian, uint16(len(s))) //nolint:errcheck
+	buf.WriteString(s)
+	return nil
+}
+
+func readString(reader *bytes.Reader) (string, error) {
+	var length uint16
+	if err := binary.Read(reader, binary.BigEndian, &length); err != nil {
+		return "", err
+	}
+	b, err := readBytes(reader, int(length))
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
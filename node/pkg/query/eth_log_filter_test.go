@@ -0,0 +1,81 @@
+package query
+
+import (
+	"testing"
+
+	ethCommon "github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEthLogFilterQueryRequestMarshalUnmarshal(t *testing.T) {
+	transferTopic := ethCommon.HexToHash("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef")
+
+	req := &EthLogFilterQueryRequest{
+		FromBlock: "0x1000000",
+		ToBlock:   "0x1000100",
+		Addresses: [][]byte{ethCommon.HexToAddress("0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2").Bytes()},
+		Topics:    [][]ethCommon.Hash{{transferTopic}, nil, nil},
+	}
+
+	b, err := req.Marshal()
+	require.NoError(t, err)
+
+	var roundTripped EthLogFilterQueryRequest
+	require.NoError(t, roundTripped.Unmarshal(b))
+
+	assert.Equal(t, req, &roundTripped)
+}
+
+func TestEthLogFilterQueryResponseMarshalUnmarshal(t *testing.T) {
+	resp := &EthLogFilterQueryResponse{
+		FromBlock:   100,
+		ToBlock:     101,
+		BlockHashes: []ethCommon.Hash{ethCommon.HexToHash("0x1"), ethCommon.HexToHash("0x2")},
+		Logs: []*EthLog{
+			{
+				Address:     ethCommon.HexToAddress("0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2").Bytes(),
+				Topics:      []ethCommon.Hash{ethCommon.HexToHash("0xabc")},
+				Data:        []byte{1, 2, 3, 4},
+				BlockNumber: 100,
+				BlockHash:   ethCommon.HexToHash("0x1"),
+				TxHash:      ethCommon.HexToHash("0xdef"),
+				TxIndex:     1,
+				LogIndex:    2,
+			},
+		},
+	}
+
+	b, err := resp.Marshal()
+	require.NoError(t, err)
+
+	var roundTripped EthLogFilterQueryResponse
+	require.NoError(t, roundTripped.Unmarshal(b))
+
+	assert.Equal(t, resp, &roundTripped)
+}
+
+func TestQueryRequestWithLogFilterMarshalUnmarshal(t *testing.T) {
+	req := &QueryRequest{
+		Nonce: 42,
+		PerChainQueries: []*PerChainQueryRequest{
+			{
+				ChainId: 2,
+				Query: &EthLogFilterQueryRequest{
+					FromBlock: "0x1",
+					ToBlock:   "0x2",
+					Addresses: [][]byte{{0xde, 0xad, 0xbe, 0xef}},
+					Topics:    [][]ethCommon.Hash{{ethCommon.HexToHash("0x1")}},
+				},
+			},
+		},
+	}
+
+	b, err := req.Marshal()
+	require.NoError(t, err)
+
+	var roundTripped QueryRequest
+	require.NoError(t, roundTripped.Unmarshal(b))
+
+	assert.Equal(t, req, &roundTripped)
+}
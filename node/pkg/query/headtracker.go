@@ -0,0 +1,217 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	ethCommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"go.uber.org/zap"
+)
+
+// TrustPolicy controls how strictly HeadTracker-observed block hashes are
+// enforced against an incoming query response for the same height.
+type TrustPolicy string
+
+const (
+	// TrustPolicyStrict rejects any response whose (BlockNumber, Hash)
+	// disagrees with the tracker's own view of that height.
+	TrustPolicyStrict TrustPolicy = "strict"
+	// TrustPolicyWarn logs a mismatch but still accepts the response. Use
+	// this while a chain's RPC endpoints are still being dialed in.
+	TrustPolicyWarn TrustPolicy = "warn"
+	// TrustPolicyOff skips cross-checking entirely, e.g. for chains with
+	// no trusted RPC endpoint configured.
+	TrustPolicyOff TrustPolicy = "off"
+)
+
+// finalizedBlock is a single entry in a HeadTracker's rolling window.
+type finalizedBlock struct {
+	Number uint64
+	Hash   ethCommon.Hash
+}
+
+// HeadTracker maintains a rolling window of recently finalized block
+// hashes per chain, polled from caller-supplied RPC endpoints. It lets a
+// query client cross-check a guardian's response against a second,
+// independently observed source of truth before trusting it, in the same
+// spirit as the block-pool sync used by early Ethereum clients.
+type HeadTracker struct {
+	logger     *zap.Logger
+	windowSize int
+	pollPeriod time.Duration
+
+	mu      sync.RWMutex
+	rpcURLs map[uint16][]string
+	window  map[uint16][]finalizedBlock
+	waiters map[uint16][]headWaiter
+}
+
+type headWaiter struct {
+	blockNum uint64
+	done     chan struct{}
+}
+
+// DefaultHeadTrackerPollPeriod is how often HeadTracker refreshes its view
+// of each chain's finalized head when Start is used.
+const DefaultHeadTrackerPollPeriod = 15 * time.Second
+
+// NewHeadTracker creates a HeadTracker that will track the given chains.
+// rpcURLs maps chain ID to one or more RPC endpoints; the first endpoint
+// that answers is used for each poll. windowSize bounds how many recent
+// finalized blocks are kept per chain.
+func NewHeadTracker(logger *zap.Logger, rpcURLs map[uint16][]string, windowSize int) *HeadTracker {
+	if windowSize <= 0 {
+		windowSize = 256
+	}
+	return &HeadTracker{
+		logger:     logger,
+		windowSize: windowSize,
+		pollPeriod: DefaultHeadTrackerPollPeriod,
+		rpcURLs:    rpcURLs,
+		window:     make(map[uint16][]finalizedBlock),
+		waiters:    make(map[uint16][]headWaiter),
+	}
+}
+
+// Start begins polling every configured chain's finalized head in the
+// background until ctx is cancelled.
+func (h *HeadTracker) Start(ctx context.Context) {
+	for chainId := range h.rpcURLs {
+		go h.pollLoop(ctx, chainId)
+	}
+}
+
+func (h *HeadTracker) pollLoop(ctx context.Context, chainId uint16) {
+	ticker := time.NewTicker(h.pollPeriod)
+	defer ticker.Stop()
+
+	h.pollOnce(ctx, chainId)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.pollOnce(ctx, chainId)
+		}
+	}
+}
+
+func (h *HeadTracker) pollOnce(ctx context.Context, chainId uint16) {
+	for _, url := range h.rpcURLs[chainId] {
+		number, hash, err := fetchFinalizedHead(ctx, url)
+		if err != nil {
+			h.logger.Warn("failed to fetch finalized head", zap.Uint16("chainId", chainId), zap.String("url", url), zap.Error(err))
+			continue
+		}
+		h.Record(chainId, number, hash)
+		return
+	}
+	h.logger.Error("all RPC endpoints failed for chain", zap.Uint16("chainId", chainId))
+}
+
+func fetchFinalizedHead(ctx context.Context, url string) (uint64, ethCommon.Hash, error) {
+	ec, err := ethclient.DialContext(ctx, url)
+	if err != nil {
+		return 0, ethCommon.Hash{}, fmt.Errorf("failed to dial %s: %w", url, err)
+	}
+	defer ec.Close()
+
+	header, err := ec.HeaderByNumber(ctx, big.NewInt(rpc.FinalizedBlockNumber.Int64()))
+	if err != nil {
+		return 0, ethCommon.Hash{}, fmt.Errorf("failed to fetch finalized header: %w", err)
+	}
+
+	return header.Number.Uint64(), header.Hash(), nil
+}
+
+// Record adds a newly observed finalized block to the window for chainId
+// and wakes any WaitForFinalized callers whose target height was reached.
+// The background poll loop started by Start calls this automatically;
+// Record is exported so callers with their own finality source (or tests)
+// can feed the tracker directly.
+func (h *HeadTracker) Record(chainId uint16, number uint64, hash ethCommon.Hash) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	window := h.window[chainId]
+	if len(window) > 0 && window[len(window)-1].Number >= number {
+		// Stale or duplicate poll result; nothing changed.
+		return
+	}
+	window = append(window, finalizedBlock{Number: number, Hash: hash})
+	if len(window) > h.windowSize {
+		window = window[len(window)-h.windowSize:]
+	}
+	h.window[chainId] = window
+
+	remaining := h.waiters[chainId][:0]
+	for _, w := range h.waiters[chainId] {
+		if w.blockNum <= number {
+			close(w.done)
+		} else {
+			remaining = append(remaining, w)
+		}
+	}
+	h.waiters[chainId] = remaining
+}
+
+// lookup returns the tracked hash for (chainId, number), if it is still in
+// the rolling window.
+func (h *HeadTracker) lookup(chainId uint16, number uint64) (ethCommon.Hash, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, b := range h.window[chainId] {
+		if b.Number == number {
+			return b.Hash, true
+		}
+	}
+	return ethCommon.Hash{}, false
+}
+
+// Verify reports whether (number, hash) matches this tracker's own view of
+// chainId at that height. The second return value is false if the tracker
+// has no opinion yet (e.g. the height is outside the window), in which
+// case callers should not treat it as a mismatch.
+func (h *HeadTracker) Verify(chainId uint16, number uint64, hash ethCommon.Hash) (matches bool, known bool) {
+	tracked, ok := h.lookup(chainId, number)
+	if !ok {
+		return false, false
+	}
+	return tracked == hash, true
+}
+
+// WaitForFinalized blocks until chainId's tracked finalized head reaches
+// blockNum, or ctx is cancelled. Callers use this to gate expensive query
+// submissions on the target block actually being finalized locally,
+// without spending any guardian bandwidth first.
+func (h *HeadTracker) WaitForFinalized(ctx context.Context, chainId uint16, blockNum uint64) error {
+	h.mu.Lock()
+	if tracked, ok := h.latestLocked(chainId); ok && tracked >= blockNum {
+		h.mu.Unlock()
+		return nil
+	}
+	done := make(chan struct{})
+	h.waiters[chainId] = append(h.waiters[chainId], headWaiter{blockNum: blockNum, done: done})
+	h.mu.Unlock()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (h *HeadTracker) latestLocked(chainId uint16) (uint64, bool) {
+	window := h.window[chainId]
+	if len(window) == 0 {
+		return 0, false
+	}
+	return window[len(window)-1].Number, true
+}
@@ -0,0 +1,81 @@
+package query
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	ethCommon "github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestHeadTrackerVerify(t *testing.T) {
+	h := NewHeadTracker(zap.NewNop(), nil, 4)
+
+	matches, known := h.Verify(2, 100, ethCommon.HexToHash("0x1"))
+	assert.False(t, known, "unpolled height should be unknown, not a mismatch")
+	assert.False(t, matches)
+
+	h.Record(2, 100, ethCommon.HexToHash("0x1"))
+
+	matches, known = h.Verify(2, 100, ethCommon.HexToHash("0x1"))
+	assert.True(t, known)
+	assert.True(t, matches)
+
+	matches, known = h.Verify(2, 100, ethCommon.HexToHash("0x2"))
+	assert.True(t, known)
+	assert.False(t, matches, "a different hash at a tracked height must not match")
+}
+
+func TestHeadTrackerWindowEviction(t *testing.T) {
+	h := NewHeadTracker(zap.NewNop(), nil, 2)
+
+	h.Record(2, 100, ethCommon.HexToHash("0x1"))
+	h.Record(2, 101, ethCommon.HexToHash("0x2"))
+	h.Record(2, 102, ethCommon.HexToHash("0x3"))
+
+	_, known := h.Verify(2, 100, ethCommon.HexToHash("0x1"))
+	assert.False(t, known, "oldest entry should have been evicted once the window filled")
+
+	_, known = h.Verify(2, 102, ethCommon.HexToHash("0x3"))
+	assert.True(t, known)
+}
+
+func TestHeadTrackerWaitForFinalized(t *testing.T) {
+	h := NewHeadTracker(zap.NewNop(), nil, 4)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	doneCh := make(chan error, 1)
+	go func() {
+		doneCh <- h.WaitForFinalized(ctx, 2, 105)
+	}()
+
+	h.Record(2, 100, ethCommon.HexToHash("0x1"))
+	h.Record(2, 105, ethCommon.HexToHash("0x2"))
+
+	require.NoError(t, <-doneCh)
+}
+
+func TestHeadTrackerWaitForFinalizedAlreadyThere(t *testing.T) {
+	h := NewHeadTracker(zap.NewNop(), nil, 4)
+	h.Record(2, 100, ethCommon.HexToHash("0x1"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	require.NoError(t, h.WaitForFinalized(ctx, 2, 50))
+}
+
+func TestHeadTrackerWaitForFinalizedTimesOut(t *testing.T) {
+	h := NewHeadTracker(zap.NewNop(), nil, 4)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := h.WaitForFinalized(ctx, 2, 100)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
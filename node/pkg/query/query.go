@@ -0,0 +1,519 @@
+// Package query defines the wire format for cross-chain query (CCQ)
+// requests and responses that are gossiped between CCQ servers and
+// guardians, and signed/verified by both sides.
+package query
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/certusone/wormhole/node/pkg/common"
+	ethCommon "github.com/ethereum/go-ethereum/common"
+	ethCrypto "github.com/ethereum/go-ethereum/crypto"
+)
+
+// readBytes reads a length-prefixed byte field off reader. length is
+// validated against the bytes actually remaining before allocating, so a
+// peer cannot force a multi-gigabyte allocation by sending a small message
+// with a bogus length prefix, and io.ReadFull (rather than a bare Read) is
+// used so a truncated payload is reported as an error instead of being
+// silently zero-padded.
+func readBytes(reader *bytes.Reader, length int) ([]byte, error) {
+	if length < 0 || length > reader.Len() {
+		return nil, fmt.Errorf("invalid length %d: only %d bytes remain", length, reader.Len())
+	}
+	b := make([]byte, length)
+	if _, err := io.ReadFull(reader, b); err != nil {
+		return nil, fmt.Errorf("failed to read %d bytes: %w", length, err)
+	}
+	return b, nil
+}
+
+// QueryType identifies the concrete type of a per-chain query request or
+// response on the wire.
+type QueryType uint8
+
+const (
+	QueryTypeInvalid QueryType = iota
+	QueryTypeEthCall
+	QueryTypeEthLogFilter
+)
+
+func (t QueryType) String() string {
+	switch t {
+	case QueryTypeEthCall:
+		return "EthCall"
+	case QueryTypeEthLogFilter:
+		return "EthLogFilter"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(t))
+	}
+}
+
+// ChainSpecificQuery is implemented by every per-chain query request type
+// (e.g. EthCallQueryRequest).
+type ChainSpecificQuery interface {
+	Type() QueryType
+	Marshal() ([]byte, error)
+	Unmarshal(data []byte) error
+}
+
+// ChainSpecificResponse is implemented by every per-chain query response
+// type (e.g. EthCallQueryResponse).
+type ChainSpecificResponse interface {
+	Type() QueryType
+	Marshal() ([]byte, error)
+	Unmarshal(data []byte) error
+}
+
+// QueryRequest is the top-level request that gets signed and gossiped to
+// guardians. It may contain queries for more than one chain.
+type QueryRequest struct {
+	Nonce           uint32
+	PerChainQueries []*PerChainQueryRequest
+}
+
+// PerChainQueryRequest pairs a chain ID with the chain-specific query to run
+// against it.
+type PerChainQueryRequest struct {
+	ChainId uint16
+	Query   ChainSpecificQuery
+}
+
+// SignedQueryRequest mirrors the fields of gossipv1.SignedQueryRequest so
+// that a QueryResponsePublication can reference the request it answers
+// without importing the gossip proto package.
+type SignedQueryRequest struct {
+	QueryRequest []byte
+	Signature    []byte
+}
+
+// QueryResponsePublication is the quorum-ready (or single-guardian, before
+// aggregation) response to a QueryRequest.
+type QueryResponsePublication struct {
+	Request           SignedQueryRequest
+	PerChainResponses []*PerChainQueryResponse
+}
+
+// PerChainQueryResponse pairs a chain ID with the chain-specific response
+// produced for the corresponding PerChainQueryRequest.
+type PerChainQueryResponse struct {
+	ChainId  uint16
+	Response ChainSpecificResponse
+}
+
+// Marshal serializes a QueryRequest as: Nonce (4 bytes) || num queries (1
+// byte) || for each query: ChainId (2 bytes) || QueryType (1 byte) ||
+// length (4 bytes) || query-specific payload.
+func (q *QueryRequest) Marshal() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.BigEndian, q.Nonce) //nolint:errcheck
+
+	if len(q.PerChainQueries) > 255 {
+		return nil, fmt.Errorf("too many per chain queries: %d", len(q.PerChainQueries))
+	}
+	buf.WriteByte(uint8(len(q.PerChainQueries)))
+
+	for _, pcq := range q.PerChainQueries {
+		b, err := pcq.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(b)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Unmarshal deserializes a QueryRequest previously produced by Marshal.
+func (q *QueryRequest) Unmarshal(data []byte) error {
+	reader := bytes.NewReader(data)
+	if err := binary.Read(reader, binary.BigEndian, &q.Nonce); err != nil {
+		return fmt.Errorf("failed to read nonce: %w", err)
+	}
+
+	numQueries, err := reader.ReadByte()
+	if err != nil {
+		return fmt.Errorf("failed to read number of per chain queries: %w", err)
+	}
+
+	q.PerChainQueries = make([]*PerChainQueryRequest, 0, numQueries)
+	for i := 0; i < int(numQueries); i++ {
+		pcq := &PerChainQueryRequest{}
+		if err := pcq.unmarshal(reader); err != nil {
+			return fmt.Errorf("failed to unmarshal per chain query %d: %w", i, err)
+		}
+		q.PerChainQueries = append(q.PerChainQueries, pcq)
+	}
+
+	if reader.Len() != 0 {
+		return fmt.Errorf("excess bytes after parsing query request")
+	}
+
+	return nil
+}
+
+// Marshal serializes a single PerChainQueryRequest.
+func (pcq *PerChainQueryRequest) Marshal() ([]byte, error) {
+	if pcq.Query == nil {
+		return nil, fmt.Errorf("per chain query request has no query")
+	}
+	payload, err := pcq.Query.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.BigEndian, pcq.ChainId)          //nolint:errcheck
+	buf.WriteByte(uint8(pcq.Query.Type()))                    //nolint:errcheck
+	binary.Write(buf, binary.BigEndian, uint32(len(payload))) //nolint:errcheck
+	buf.Write(payload)
+	return buf.Bytes(), nil
+}
+
+func (pcq *PerChainQueryRequest) unmarshal(reader *bytes.Reader) error {
+	if err := binary.Read(reader, binary.BigEndian, &pcq.ChainId); err != nil {
+		return fmt.Errorf("failed to read chain id: %w", err)
+	}
+
+	queryType, err := reader.ReadByte()
+	if err != nil {
+		return fmt.Errorf("failed to read query type: %w", err)
+	}
+
+	var length uint32
+	if err := binary.Read(reader, binary.BigEndian, &length); err != nil {
+		return fmt.Errorf("failed to read query length: %w", err)
+	}
+
+	payload, err := readBytes(reader, int(length))
+	if err != nil {
+		return fmt.Errorf("failed to read query payload: %w", err)
+	}
+
+	query, err := newChainSpecificQuery(QueryType(queryType))
+	if err != nil {
+		return err
+	}
+	if err := query.Unmarshal(payload); err != nil {
+		return fmt.Errorf("failed to unmarshal query payload: %w", err)
+	}
+
+	pcq.Query = query
+	return nil
+}
+
+func newChainSpecificQuery(t QueryType) (ChainSpecificQuery, error) {
+	switch t {
+	case QueryTypeEthCall:
+		return &EthCallQueryRequest{}, nil
+	case QueryTypeEthLogFilter:
+		return &EthLogFilterQueryRequest{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported query type: %v", t)
+	}
+}
+
+func newChainSpecificResponse(t QueryType) (ChainSpecificResponse, error) {
+	switch t {
+	case QueryTypeEthCall:
+		return &EthCallQueryResponse{}, nil
+	case QueryTypeEthLogFilter:
+		return &EthLogFilterQueryResponse{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported response type: %v", t)
+	}
+}
+
+// Marshal serializes a QueryResponsePublication the same way Marshal/
+// Unmarshal encode a QueryRequest: length-prefixed request fields followed
+// by a count and sequence of per-chain responses.
+func (r *QueryResponsePublication) Marshal() ([]byte, error) {
+	buf := new(bytes.Buffer)
+
+	binary.Write(buf, binary.BigEndian, uint32(len(r.Request.QueryRequest))) //nolint:errcheck
+	buf.Write(r.Request.QueryRequest)
+	binary.Write(buf, binary.BigEndian, uint32(len(r.Request.Signature))) //nolint:errcheck
+	buf.Write(r.Request.Signature)
+
+	if len(r.PerChainResponses) > 255 {
+		return nil, fmt.Errorf("too many per chain responses: %d", len(r.PerChainResponses))
+	}
+	buf.WriteByte(uint8(len(r.PerChainResponses)))
+
+	for _, pcr := range r.PerChainResponses {
+		b, err := pcr.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(b)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Unmarshal deserializes a QueryResponsePublication previously produced by
+// Marshal.
+func (r *QueryResponsePublication) Unmarshal(data []byte) error {
+	reader := bytes.NewReader(data)
+
+	var reqLen uint32
+	if err := binary.Read(reader, binary.BigEndian, &reqLen); err != nil {
+		return fmt.Errorf("failed to read request length: %w", err)
+	}
+	reqBytes, err := readBytes(reader, int(reqLen))
+	if err != nil {
+		return fmt.Errorf("failed to read request bytes: %w", err)
+	}
+	r.Request.QueryRequest = reqBytes
+
+	var sigLen uint32
+	if err := binary.Read(reader, binary.BigEndian, &sigLen); err != nil {
+		return fmt.Errorf("failed to read signature length: %w", err)
+	}
+	sigBytes, err := readBytes(reader, int(sigLen))
+	if err != nil {
+		return fmt.Errorf("failed to read signature bytes: %w", err)
+	}
+	r.Request.Signature = sigBytes
+
+	numResponses, err := reader.ReadByte()
+	if err != nil {
+		return fmt.Errorf("failed to read number of per chain responses: %w", err)
+	}
+
+	r.PerChainResponses = make([]*PerChainQueryResponse, 0, numResponses)
+	for i := 0; i < int(numResponses); i++ {
+		pcr := &PerChainQueryResponse{}
+		if err := pcr.unmarshal(reader); err != nil {
+			return fmt.Errorf("failed to unmarshal per chain response %d: %w", i, err)
+		}
+		r.PerChainResponses = append(r.PerChainResponses, pcr)
+	}
+
+	if reader.Len() != 0 {
+		return fmt.Errorf("excess bytes after parsing query response")
+	}
+
+	return nil
+}
+
+// Marshal serializes a single PerChainQueryResponse.
+func (pcr *PerChainQueryResponse) Marshal() ([]byte, error) {
+	if pcr.Response == nil {
+		return nil, fmt.Errorf("per chain query response has no response")
+	}
+	payload, err := pcr.Response.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.BigEndian, pcr.ChainId)          //nolint:errcheck
+	buf.WriteByte(uint8(pcr.Response.Type()))                 //nolint:errcheck
+	binary.Write(buf, binary.BigEndian, uint32(len(payload))) //nolint:errcheck
+	buf.Write(payload)
+	return buf.Bytes(), nil
+}
+
+func (pcr *PerChainQueryResponse) unmarshal(reader *bytes.Reader) error {
+	if err := binary.Read(reader, binary.BigEndian, &pcr.ChainId); err != nil {
+		return fmt.Errorf("failed to read chain id: %w", err)
+	}
+
+	responseType, err := reader.ReadByte()
+	if err != nil {
+		return fmt.Errorf("failed to read response type: %w", err)
+	}
+
+	var length uint32
+	if err := binary.Read(reader, binary.BigEndian, &length); err != nil {
+		return fmt.Errorf("failed to read response length: %w", err)
+	}
+
+	payload, err := readBytes(reader, int(length))
+	if err != nil {
+		return fmt.Errorf("failed to read response payload: %w", err)
+	}
+
+	response, err := newChainSpecificResponse(QueryType(responseType))
+	if err != nil {
+		return err
+	}
+	if err := response.Unmarshal(payload); err != nil {
+		return fmt.Errorf("failed to unmarshal response payload: %w", err)
+	}
+
+	pcr.Response = response
+	return nil
+}
+
+// EthCallData is a single address/calldata pair to be passed to eth_call.
+type EthCallData struct {
+	To   []byte
+	Data []byte
+}
+
+// EthCallQueryRequest performs one or more eth_call requests against a
+// single, fixed block (specified by number, hash, or tag such as "latest").
+type EthCallQueryRequest struct {
+	BlockId  string
+	CallData []*EthCallData
+}
+
+func (q *EthCallQueryRequest) Type() QueryType { return QueryTypeEthCall }
+
+func (q *EthCallQueryRequest) Marshal() ([]byte, error) {
+	buf := new(bytes.Buffer)
+
+	binary.Write(buf, binary.BigEndian, uint32(len(q.BlockId))) //nolint:errcheck
+	buf.WriteString(q.BlockId)
+
+	if len(q.CallData) > 255 {
+		return nil, fmt.Errorf("too many call data entries: %d", len(q.CallData))
+	}
+	buf.WriteByte(uint8(len(q.CallData)))
+
+	for _, cd := range q.CallData {
+		binary.Write(buf, binary.BigEndian, uint32(len(cd.To))) //nolint:errcheck
+		buf.Write(cd.To)
+		binary.Write(buf, binary.BigEndian, uint32(len(cd.Data))) //nolint:errcheck
+		buf.Write(cd.Data)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (q *EthCallQueryRequest) Unmarshal(data []byte) error {
+	reader := bytes.NewReader(data)
+
+	var blockIdLen uint32
+	if err := binary.Read(reader, binary.BigEndian, &blockIdLen); err != nil {
+		return fmt.Errorf("failed to read block id length: %w", err)
+	}
+	blockId, err := readBytes(reader, int(blockIdLen))
+	if err != nil {
+		return fmt.Errorf("failed to read block id: %w", err)
+	}
+	q.BlockId = string(blockId)
+
+	numCallData, err := reader.ReadByte()
+	if err != nil {
+		return fmt.Errorf("failed to read number of call data entries: %w", err)
+	}
+
+	q.CallData = make([]*EthCallData, 0, numCallData)
+	for i := 0; i < int(numCallData); i++ {
+		var toLen uint32
+		if err := binary.Read(reader, binary.BigEndian, &toLen); err != nil {
+			return fmt.Errorf("failed to read to length: %w", err)
+		}
+		to, err := readBytes(reader, int(toLen))
+		if err != nil {
+			return fmt.Errorf("failed to read to: %w", err)
+		}
+
+		var dataLen uint32
+		if err := binary.Read(reader, binary.BigEndian, &dataLen); err != nil {
+			return fmt.Errorf("failed to read data length: %w", err)
+		}
+		callData, err := readBytes(reader, int(dataLen))
+		if err != nil {
+			return fmt.Errorf("failed to read data: %w", err)
+		}
+
+		q.CallData = append(q.CallData, &EthCallData{To: to, Data: callData})
+	}
+
+	return nil
+}
+
+// EthCallQueryResponse is the result of running an EthCallQueryRequest at a
+// specific, now-known block.
+type EthCallQueryResponse struct {
+	BlockNumber uint64
+	Hash        ethCommon.Hash
+	Time        time.Time
+	Results     [][]byte
+}
+
+func (r *EthCallQueryResponse) Type() QueryType { return QueryTypeEthCall }
+
+func (r *EthCallQueryResponse) Marshal() ([]byte, error) {
+	buf := new(bytes.Buffer)
+
+	binary.Write(buf, binary.BigEndian, r.BlockNumber)      //nolint:errcheck
+	buf.Write(r.Hash.Bytes())                               //nolint:errcheck
+	binary.Write(buf, binary.BigEndian, r.Time.UnixMicro()) //nolint:errcheck
+
+	if len(r.Results) > 255 {
+		return nil, fmt.Errorf("too many results: %d", len(r.Results))
+	}
+	buf.WriteByte(uint8(len(r.Results)))
+	for _, result := range r.Results {
+		binary.Write(buf, binary.BigEndian, uint32(len(result))) //nolint:errcheck
+		buf.Write(result)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (r *EthCallQueryResponse) Unmarshal(data []byte) error {
+	reader := bytes.NewReader(data)
+
+	if err := binary.Read(reader, binary.BigEndian, &r.BlockNumber); err != nil {
+		return fmt.Errorf("failed to read block number: %w", err)
+	}
+
+	hashBytes, err := readBytes(reader, ethCommon.HashLength)
+	if err != nil {
+		return fmt.Errorf("failed to read hash: %w", err)
+	}
+	r.Hash = ethCommon.BytesToHash(hashBytes)
+
+	var micros int64
+	if err := binary.Read(reader, binary.BigEndian, &micros); err != nil {
+		return fmt.Errorf("failed to read time: %w", err)
+	}
+	r.Time = time.UnixMicro(micros).UTC()
+
+	numResults, err := reader.ReadByte()
+	if err != nil {
+		return fmt.Errorf("failed to read number of results: %w", err)
+	}
+
+	r.Results = make([][]byte, 0, numResults)
+	for i := 0; i < int(numResults); i++ {
+		var length uint32
+		if err := binary.Read(reader, binary.BigEndian, &length); err != nil {
+			return fmt.Errorf("failed to read result length: %w", err)
+		}
+		result, err := readBytes(reader, int(length))
+		if err != nil {
+			return fmt.Errorf("failed to read result: %w", err)
+		}
+		r.Results = append(r.Results, result)
+	}
+
+	return nil
+}
+
+// QueryRequestDigest returns the hash that guardians sign/verify over a
+// raw, marshaled QueryRequest for a given network.
+func QueryRequestDigest(env common.Environment, b []byte) ethCommon.Hash {
+	return signingDigest("query_request", env, b)
+}
+
+// QueryResponseDigest returns the hash that guardians sign/verify over a
+// raw, marshaled QueryResponsePublication for a given network.
+func QueryResponseDigest(env common.Environment, b []byte) ethCommon.Hash {
+	return signingDigest("query_response", env, b)
+}
+
+func signingDigest(domain string, env common.Environment, b []byte) ethCommon.Hash {
+	prefix := ethCrypto.Keccak256Hash([]byte(fmt.Sprintf("%s:%s", domain, env)))
+	return ethCrypto.Keccak256Hash(append(prefix.Bytes(), ethCrypto.Keccak256Hash(b).Bytes()...))
+}
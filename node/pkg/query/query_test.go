@@ -0,0 +1,103 @@
+package query
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/certusone/wormhole/node/pkg/common"
+	ethCommon "github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEthCallQueryRequestMarshalUnmarshal(t *testing.T) {
+	req := &EthCallQueryRequest{
+		BlockId: "0x1000000",
+		CallData: []*EthCallData{
+			{To: ethCommon.HexToAddress("0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2").Bytes(), Data: []byte{0x18, 0x16, 0x0d, 0xdd}},
+		},
+	}
+
+	b, err := req.Marshal()
+	require.NoError(t, err)
+
+	var roundTripped EthCallQueryRequest
+	require.NoError(t, roundTripped.Unmarshal(b))
+
+	assert.Equal(t, req, &roundTripped)
+}
+
+func TestEthCallQueryResponseMarshalUnmarshal(t *testing.T) {
+	resp := &EthCallQueryResponse{
+		BlockNumber: 12345,
+		Hash:        ethCommon.HexToHash("0x1"),
+		Time:        time.UnixMicro(1_700_000_000_000_000).UTC(),
+		Results:     [][]byte{{1, 2, 3}, {}},
+	}
+
+	b, err := resp.Marshal()
+	require.NoError(t, err)
+
+	var roundTripped EthCallQueryResponse
+	require.NoError(t, roundTripped.Unmarshal(b))
+
+	assert.Equal(t, resp, &roundTripped)
+}
+
+func TestQueryRequestMarshalUnmarshal(t *testing.T) {
+	req := &QueryRequest{
+		Nonce: 7,
+		PerChainQueries: []*PerChainQueryRequest{
+			{ChainId: 2, Query: &EthCallQueryRequest{BlockId: "latest", CallData: []*EthCallData{{To: []byte{0x1}, Data: []byte{0x2}}}}},
+		},
+	}
+
+	b, err := req.Marshal()
+	require.NoError(t, err)
+
+	var roundTripped QueryRequest
+	require.NoError(t, roundTripped.Unmarshal(b))
+
+	assert.Equal(t, req, &roundTripped)
+}
+
+func TestQueryResponsePublicationMarshalUnmarshal(t *testing.T) {
+	resp := &QueryResponsePublication{
+		Request: SignedQueryRequest{QueryRequest: []byte{1, 2, 3}, Signature: []byte{4, 5, 6}},
+		PerChainResponses: []*PerChainQueryResponse{
+			{ChainId: 2, Response: &EthCallQueryResponse{BlockNumber: 1, Hash: ethCommon.HexToHash("0x1"), Time: time.UnixMicro(1).UTC(), Results: [][]byte{{1}}}},
+		},
+	}
+
+	b, err := resp.Marshal()
+	require.NoError(t, err)
+
+	var roundTripped QueryResponsePublication
+	require.NoError(t, roundTripped.Unmarshal(b))
+
+	assert.Equal(t, resp, &roundTripped)
+}
+
+func TestQueryRequestDigestAndResponseDigestDiffer(t *testing.T) {
+	b := []byte{1, 2, 3}
+	assert.NotEqual(t, QueryRequestDigest(common.MainNet, b), QueryResponseDigest(common.MainNet, b))
+}
+
+// TestReadBytesRejectsLengthBeyondRemainingData guards against a remote peer
+// claiming an oversized length prefix (e.g. 4GB) on a tiny message: readBytes
+// must reject it before allocating, rather than let make([]byte, length)
+// attempt the allocation.
+func TestReadBytesRejectsLengthBeyondRemainingData(t *testing.T) {
+	reader := bytes.NewReader([]byte{1, 2, 3})
+	_, err := readBytes(reader, 1<<31)
+	require.Error(t, err)
+}
+
+// TestReadBytesRejectsTruncatedPayload guards against a truncated payload
+// being silently zero-padded instead of erroring.
+func TestReadBytesRejectsTruncatedPayload(t *testing.T) {
+	reader := bytes.NewReader([]byte{1, 2, 3})
+	_, err := readBytes(reader, 4)
+	require.Error(t, err)
+}
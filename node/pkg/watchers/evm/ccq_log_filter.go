@@ -0,0 +1,139 @@
+package evm
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/certusone/wormhole/node/pkg/query"
+	ethereum "github.com/ethereum/go-ethereum"
+	ethCommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// maxLogFilterBlockRange and maxLogFilterResults bound the work a single
+// EthLogFilterQueryRequest can ask a guardian to do, mirroring the limits
+// imposed by most public eth_getLogs RPC providers.
+const (
+	maxLogFilterBlockRange = uint64(2_000)
+	maxLogFilterResults    = 10_000
+)
+
+// LogFilterConnector is the subset of the watcher's EVM RPC connector
+// needed to service a log-filter query. It is satisfied by the watcher's
+// real connectors.Connector, and is narrowed here so query handling can be
+// unit tested without a live RPC endpoint.
+type LogFilterConnector interface {
+	FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error)
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+}
+
+// handleLogFilterQuery executes req against conn and returns a
+// EthLogFilterQueryResponse. finalizedBlock is the chain's current finalized
+// block number as observed by this watcher; requests reaching past it are
+// rejected rather than served against an unconfirmed, potentially
+// reorg-able range.
+func handleLogFilterQuery(ctx context.Context, conn LogFilterConnector, req *query.EthLogFilterQueryRequest, finalizedBlock uint64) (*query.EthLogFilterQueryResponse, error) {
+	fromBlock, err := parseLogFilterBlockNumber(req.FromBlock, finalizedBlock)
+	if err != nil {
+		return nil, fmt.Errorf("invalid from block %q: %w", req.FromBlock, err)
+	}
+	toBlock, err := parseLogFilterBlockNumber(req.ToBlock, finalizedBlock)
+	if err != nil {
+		return nil, fmt.Errorf("invalid to block %q: %w", req.ToBlock, err)
+	}
+	if toBlock < fromBlock {
+		return nil, fmt.Errorf("to block %d is before from block %d", toBlock, fromBlock)
+	}
+	if toBlock > finalizedBlock {
+		return nil, fmt.Errorf("to block %d is beyond the finalized head %d", toBlock, finalizedBlock)
+	}
+	if toBlock-fromBlock+1 > maxLogFilterBlockRange {
+		return nil, fmt.Errorf("block range of %d exceeds the maximum of %d", toBlock-fromBlock+1, maxLogFilterBlockRange)
+	}
+
+	addrs := make([]ethCommon.Address, len(req.Addresses))
+	for i, a := range req.Addresses {
+		addrs[i] = ethCommon.BytesToAddress(a)
+	}
+
+	logs, err := conn.FilterLogs(ctx, ethereum.FilterQuery{
+		FromBlock: new(big.Int).SetUint64(fromBlock),
+		ToBlock:   new(big.Int).SetUint64(toBlock),
+		Addresses: addrs,
+		Topics:    req.Topics,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to filter logs: %w", err)
+	}
+	if len(logs) > maxLogFilterResults {
+		return nil, fmt.Errorf("result set of %d logs exceeds the maximum of %d", len(logs), maxLogFilterResults)
+	}
+
+	blockHashes, err := fetchCanonicalBlockHashes(ctx, conn, fromBlock, toBlock)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch canonical block hashes: %w", err)
+	}
+
+	resp := &query.EthLogFilterQueryResponse{
+		FromBlock:   fromBlock,
+		ToBlock:     toBlock,
+		BlockHashes: blockHashes,
+		Logs:        make([]*query.EthLog, 0, len(logs)),
+	}
+	for _, l := range logs {
+		resp.Logs = append(resp.Logs, &query.EthLog{
+			Address:     l.Address.Bytes(),
+			Topics:      l.Topics,
+			Data:        l.Data,
+			BlockNumber: l.BlockNumber,
+			BlockHash:   l.BlockHash,
+			TxHash:      l.TxHash,
+			TxIndex:     uint32(l.TxIndex),
+			LogIndex:    uint32(l.Index),
+		})
+	}
+
+	return resp, nil
+}
+
+// fetchCanonicalBlockHashes returns the canonical header hash of every
+// block in [fromBlock, toBlock], so that independent guardians answering
+// from different RPC providers can be compared for quorum even when Logs
+// is empty.
+func fetchCanonicalBlockHashes(ctx context.Context, conn LogFilterConnector, fromBlock, toBlock uint64) ([]ethCommon.Hash, error) {
+	hashes := make([]ethCommon.Hash, 0, toBlock-fromBlock+1)
+	for num := fromBlock; num <= toBlock; num++ {
+		header, err := conn.HeaderByNumber(ctx, new(big.Int).SetUint64(num))
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch header %d: %w", num, err)
+		}
+		hashes = append(hashes, header.Hash())
+	}
+	return hashes, nil
+}
+
+// parseLogFilterBlockNumber resolves a EthLogFilterQueryRequest block
+// identifier, which (per the request's doc comment) may be a hex-encoded
+// number or a tag such as "latest"/"finalized"/"safe", the same as
+// EthCallQueryRequest.BlockId. Tags that refer to the chain's current head
+// all resolve to finalizedBlock, since handleLogFilterQuery never serves a
+// range past it anyway; "pending" is rejected as CCQ only answers for
+// confirmed state.
+func parseLogFilterBlockNumber(blockId string, finalizedBlock uint64) (uint64, error) {
+	var bn rpc.BlockNumber
+	if err := bn.UnmarshalJSON([]byte(`"` + blockId + `"`)); err != nil {
+		return 0, err
+	}
+	switch bn {
+	case rpc.PendingBlockNumber:
+		return 0, fmt.Errorf("pending block is not supported in a log filter query")
+	case rpc.EarliestBlockNumber:
+		return 0, nil
+	case rpc.LatestBlockNumber, rpc.FinalizedBlockNumber, rpc.SafeBlockNumber:
+		return finalizedBlock, nil
+	default:
+		return uint64(bn.Int64()), nil
+	}
+}
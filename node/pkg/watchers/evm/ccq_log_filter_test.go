@@ -0,0 +1,115 @@
+package evm
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/certusone/wormhole/node/pkg/query"
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockLogFilterConnector struct {
+	logs    []types.Log
+	headers map[uint64]*types.Header
+}
+
+func (m *mockLogFilterConnector) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	return m.logs, nil
+}
+
+func (m *mockLogFilterConnector) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	return m.headers[number.Uint64()], nil
+}
+
+func newMockConnectorWithHeaders(from, to uint64) *mockLogFilterConnector {
+	headers := make(map[uint64]*types.Header, to-from+1)
+	for n := from; n <= to; n++ {
+		headers[n] = &types.Header{Number: new(big.Int).SetUint64(n), Extra: []byte{byte(n)}}
+	}
+	return &mockLogFilterConnector{headers: headers}
+}
+
+func TestHandleLogFilterQueryHappyPath(t *testing.T) {
+	conn := newMockConnectorWithHeaders(100, 102)
+	req := &query.EthLogFilterQueryRequest{
+		FromBlock: "0x64",
+		ToBlock:   "0x66",
+	}
+
+	resp, err := handleLogFilterQuery(context.Background(), conn, req, 200)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(100), resp.FromBlock)
+	assert.Equal(t, uint64(102), resp.ToBlock)
+	assert.Len(t, resp.BlockHashes, 3)
+}
+
+func TestHandleLogFilterQueryRejectsBeyondFinalized(t *testing.T) {
+	conn := newMockConnectorWithHeaders(100, 102)
+	req := &query.EthLogFilterQueryRequest{
+		FromBlock: "0x64",
+		ToBlock:   "0x66",
+	}
+
+	_, err := handleLogFilterQuery(context.Background(), conn, req, 101)
+	assert.Error(t, err)
+}
+
+func TestHandleLogFilterQueryRejectsExcessiveRange(t *testing.T) {
+	conn := newMockConnectorWithHeaders(0, 0)
+	req := &query.EthLogFilterQueryRequest{
+		FromBlock: "0x0",
+		ToBlock:   hexString(maxLogFilterBlockRange),
+	}
+
+	_, err := handleLogFilterQuery(context.Background(), conn, req, maxLogFilterBlockRange*2)
+	assert.Error(t, err)
+}
+
+func TestHandleLogFilterQueryRejectsExcessiveResults(t *testing.T) {
+	conn := newMockConnectorWithHeaders(0, 0)
+	conn.logs = make([]types.Log, maxLogFilterResults+1)
+	req := &query.EthLogFilterQueryRequest{
+		FromBlock: "0x0",
+		ToBlock:   "0x0",
+	}
+
+	_, err := handleLogFilterQuery(context.Background(), conn, req, 10)
+	assert.Error(t, err)
+}
+
+func hexString(n uint64) string {
+	return fmt.Sprintf("0x%x", n)
+}
+
+func TestHandleLogFilterQueryResolvesLatestAndFinalizedTags(t *testing.T) {
+	conn := newMockConnectorWithHeaders(100, 102)
+	req := &query.EthLogFilterQueryRequest{
+		FromBlock: "0x64",
+		ToBlock:   "latest",
+	}
+
+	resp, err := handleLogFilterQuery(context.Background(), conn, req, 102)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(102), resp.ToBlock)
+
+	req.ToBlock = "finalized"
+	resp, err = handleLogFilterQuery(context.Background(), conn, req, 102)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(102), resp.ToBlock)
+}
+
+func TestHandleLogFilterQueryRejectsPendingTag(t *testing.T) {
+	conn := newMockConnectorWithHeaders(0, 0)
+	req := &query.EthLogFilterQueryRequest{
+		FromBlock: "0x0",
+		ToBlock:   "pending",
+	}
+
+	_, err := handleLogFilterQuery(context.Background(), conn, req, 10)
+	assert.Error(t, err)
+}